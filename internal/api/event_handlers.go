@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/user/cppjudge/internal/judge"
+	"github.com/user/cppjudge/internal/models"
+)
+
+const (
+	// sseTickInterval is how often the queue position of a waiting submission is refreshed
+	sseTickInterval = time.Second
+	// sseHeartbeatTicks keeps idle connections and proxies from timing out
+	sseHeartbeatTicks = 15
+)
+
+// StreamSubmission streams the judging progress of a submission as
+// Server-Sent Events: "status" when the status or queue position changes,
+// "test_result" for every finished test case and a final "done" carrying the
+// submission. Progress made before the client connected is replayed first.
+func (h *Handler) StreamSubmission(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 先订阅再读取当前状态，避免遗漏两者之间发布的事件
+	events, cancel := h.judgeService.Events().Subscribe(id)
+	defer cancel()
+
+	submission, err := h.store.GetSubmissionByID(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+	testCases, err := h.store.GetTestCasesByProblemID(submission.ProblemID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test cases")
+		return
+	}
+	results, err := h.store.GetTestResultsBySubmissionID(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test results")
+		return
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	// The stream may outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("清除SSE写超时失败: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Replay the current state
+	status := submission.Status
+	position := h.judgeQueue.Position(id)
+	writeEvent(w, judge.EventStatus, statusEvent(id, status, position))
+
+	sent := make(map[int]bool, len(results))
+	for _, result := range results {
+		writeEvent(w, judge.EventTestResult, newTestVerdict(result, testCases))
+		sent[result.ID] = true
+	}
+
+	if isFinalStatus(status) {
+		writeEvent(w, judge.EventDone, publicSubmission(submission))
+		rc.Flush()
+		return
+	}
+	rc.Flush()
+
+	ticker := time.NewTicker(sseTickInterval)
+	defer ticker.Stop()
+	ticks := 0
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-ticker.C:
+			ticks++
+			if status == judge.StatusPending {
+				if p := h.judgeQueue.Position(id); p != position {
+					position = p
+					writeEvent(w, judge.EventStatus, statusEvent(id, status, position))
+				}
+			}
+			if ticks%sseHeartbeatTicks == 0 {
+				fmt.Fprint(w, ": ping\n\n")
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				// 订阅者落后过多被移除，客户端可重新连接获取最新状态
+				return
+			}
+
+			switch event.Type {
+			case judge.EventStatus:
+				status = event.Status
+				position = 0
+				writeEvent(w, judge.EventStatus, statusEvent(id, status, position))
+			case judge.EventTestResult:
+				if sent[event.TestResult.ID] {
+					continue
+				}
+				sent[event.TestResult.ID] = true
+				writeEvent(w, judge.EventTestResult, newTestVerdict(*event.TestResult, testCases))
+			case judge.EventDone:
+				writeEvent(w, judge.EventDone, publicSubmission(*event.Submission))
+				rc.Flush()
+				return
+			}
+		}
+
+		rc.Flush()
+	}
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("序列化SSE事件失败: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// statusEvent is the payload of a "status" event
+func statusEvent(submissionID int, status string, position int) map[string]interface{} {
+	return map[string]interface{}{
+		"submission_id":  submissionID,
+		"status":         status,
+		"queue_position": position,
+	}
+}
+
+// publicSubmission strips the source code from a submission sent to watchers
+func publicSubmission(submission models.Submission) models.Submission {
+	submission.Code = ""
+	return submission
+}
+
+// isFinalStatus reports whether judging of a submission has finished
+func isFinalStatus(status string) bool {
+	return status != judge.StatusPending && status != judge.StatusTesting
+}
@@ -6,27 +6,41 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/user/cppjudge/internal/data"
 	"github.com/user/cppjudge/internal/db"
 	"github.com/user/cppjudge/internal/judge"
 	"github.com/user/cppjudge/internal/models"
+	"github.com/user/cppjudge/internal/sandbox"
 	"github.com/user/cppjudge/internal/utils"
 )
 
 // Handler provides HTTP handlers for the API
 type Handler struct {
-	store        *db.MemoryStore
+	store        db.Store
 	judgeService *judge.Judge
+	judgeQueue   *judge.Queue
+
+	// Custom runs bypass the judge queue, so they are rate limited per user
+	// and bounded in number
+	runLimiter *rateLimiter
+	runSlots   chan struct{}
 }
 
-// NewHandler creates a new handler with the given store and judge service
-func NewHandler(store *db.MemoryStore, judgeService *judge.Judge) *Handler {
+// NewHandler creates a new handler with the given store, judge service and judge queue
+func NewHandler(store db.Store, judgeService *judge.Judge, judgeQueue *judge.Queue) *Handler {
 	return &Handler{
 		store:        store,
 		judgeService: judgeService,
+		judgeQueue:   judgeQueue,
+		runLimiter:   newRateLimiter(runRateLimit, runRateWindow),
+		runSlots:     make(chan struct{}, runtime.NumCPU()),
 	}
 }
 
@@ -59,8 +73,8 @@ func parseID(r *http.Request) (int, error) {
 	// Get the last part of the path which should be the ID
 	idStr := pathParts[len(pathParts)-1]
 
-	// For paths ending with /testcases or /submissions, get the second last part
-	if idStr == "testcases" || idStr == "submissions" {
+	// For paths ending with /testcases, /submissions, /run, /tests, /events or /rejudge, get the second last part
+	if idStr == "testcases" || idStr == "submissions" || idStr == "run" || idStr == "tests" || idStr == "events" || idStr == "rejudge" {
 		if len(pathParts) < 2 {
 			return 0, errors.New("missing ID parameter")
 		}
@@ -75,6 +89,87 @@ func parseID(r *http.Request) (int, error) {
 	return id, nil
 }
 
+// parseTestCasePath extracts the problem and test case IDs from a
+// /api/problems/{id}/testcases/{testCaseID} path
+func parseTestCasePath(r *http.Request) (int, int, error) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) < 4 || pathParts[len(pathParts)-2] != "testcases" {
+		return 0, 0, errors.New("missing ID parameter")
+	}
+
+	problemID, err := strconv.Atoi(pathParts[len(pathParts)-3])
+	if err != nil {
+		return 0, 0, errors.New("invalid ID parameter")
+	}
+	testCaseID, err := strconv.Atoi(pathParts[len(pathParts)-1])
+	if err != nil {
+		return 0, 0, errors.New("invalid ID parameter")
+	}
+
+	return problemID, testCaseID, nil
+}
+
+// ioFileNamePattern matches the names of problem I/O files, without extension
+var ioFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateProblemSettings checks a problem's output comparison, I/O mode,
+// interactor, subtask and compiler profile settings
+func validateProblemSettings(problem models.Problem) error {
+	if !sandbox.IsCompareMode(problem.CompareMode) {
+		return fmt.Errorf("unknown compare mode %q", problem.CompareMode)
+	}
+	if problem.Epsilon < 0 {
+		return errors.New("epsilon must not be negative")
+	}
+	switch problem.IOMode {
+	case "", models.IOModeStdio:
+	case models.IOModeFile:
+		if !ioFileNamePattern.MatchString(problem.IOFileName) {
+			return fmt.Errorf("invalid I/O file name %q", problem.IOFileName)
+		}
+	default:
+		return fmt.Errorf("unknown I/O mode %q", problem.IOMode)
+	}
+	// 交互题的输出由交互程序判定，且只能通过标准输入输出交互
+	if problem.Interactor != "" {
+		if problem.Checker != "" {
+			return errors.New("interactive problems cannot have a checker")
+		}
+		if problem.IOMode == models.IOModeFile {
+			return errors.New("interactive problems must use standard I/O")
+		}
+	}
+	for _, id := range problem.CompilerProfiles {
+		if _, ok := sandbox.LookupCompilerProfile(id); !ok {
+			return fmt.Errorf("unknown compiler profile %q", id)
+		}
+	}
+
+	// 子任务只能依赖编号更小的子任务，保证不存在循环依赖
+	subtaskIDs := make(map[int]bool, len(problem.Subtasks))
+	for _, st := range problem.Subtasks {
+		if st.ID <= 0 || subtaskIDs[st.ID] {
+			return fmt.Errorf("invalid or duplicate subtask id %d", st.ID)
+		}
+		subtaskIDs[st.ID] = true
+		if st.Score < 0 {
+			return fmt.Errorf("subtask %d: score must not be negative", st.ID)
+		}
+		if st.Scoring != "" && st.Scoring != models.SubtaskScoringMin && st.Scoring != models.SubtaskScoringSum {
+			return fmt.Errorf("subtask %d: unknown scoring %q", st.ID, st.Scoring)
+		}
+	}
+	for _, st := range problem.Subtasks {
+		for _, dep := range st.DependsOn {
+			if dep >= st.ID || !subtaskIDs[dep] {
+				return fmt.Errorf("subtask %d: invalid dependency %d", st.ID, dep)
+			}
+		}
+	}
+
+	return nil
+}
+
 // GetProblems returns a list of all problems
 func (h *Handler) GetProblems(w http.ResponseWriter, r *http.Request) {
 	problems := h.store.ListProblems()
@@ -133,6 +228,11 @@ func (h *Handler) CreateProblem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateProblemSettings(problem); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Set default values if not provided
 	if problem.TimeLimit == 0 {
 		problem.TimeLimit = 1000 // 1 second
@@ -142,7 +242,12 @@ func (h *Handler) CreateProblem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the problem
-	newProblem, err := h.store.AddProblem(problem)
+	var newProblem models.Problem
+	_, err := h.createProblems(r, func() ([]int, error) {
+		var err error
+		newProblem, err = h.store.AddProblem(problem)
+		return []int{newProblem.ID}, err
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to create problem")
 		return
@@ -174,8 +279,26 @@ func (h *Handler) AddTestCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The subtask, if any, must exist
+	if testCase.Subtask != 0 {
+		problem, err := h.store.GetProblemByID(problemID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Problem not found")
+			return
+		}
+		if !hasSubtask(problem, testCase.Subtask) {
+			respondError(w, http.StatusBadRequest, "Subtask not found")
+			return
+		}
+	}
+
 	// Create the test case
-	newTestCase, err := h.store.AddTestCase(testCase)
+	var newTestCase models.TestCase
+	err = h.changeProblem(r, problemID, models.RevisionAddTestCase, func() error {
+		var err error
+		newTestCase, err = h.store.AddTestCase(testCase)
+		return err
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to create test case")
 		return
@@ -184,6 +307,124 @@ func (h *Handler) AddTestCase(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, newTestCase)
 }
 
+// GetTestCases returns the example test cases of a problem. Hidden test cases
+// are never exposed, as in GetProblem.
+func (h *Handler) GetTestCases(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.store.GetProblemByID(problemID); err != nil {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	testCases, err := h.store.GetTestCasesByProblemID(problemID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test cases")
+		return
+	}
+
+	examples := make([]models.TestCase, 0, len(testCases))
+	for _, tc := range testCases {
+		if tc.IsExample {
+			examples = append(examples, tc)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, examples)
+}
+
+// UpdateTestCase replaces a test case of a problem. Finished submissions keep
+// their results until they are rejudged.
+func (h *Handler) UpdateTestCase(w http.ResponseWriter, r *http.Request) {
+	problemID, testCaseID, err := parseTestCasePath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var testCase models.TestCase
+	if err := json.NewDecoder(r.Body).Decode(&testCase); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	testCase.ID = testCaseID
+	testCase.ProblemID = problemID
+
+	if testCase.Input == "" || testCase.Output == "" {
+		respondError(w, http.StatusBadRequest, "Input and output are required")
+		return
+	}
+
+	problem, err := h.store.GetProblemByID(problemID)
+	if errors.Is(err, data.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve problem")
+		return
+	}
+	if testCase.Subtask != 0 && !hasSubtask(problem, testCase.Subtask) {
+		respondError(w, http.StatusBadRequest, "Subtask not found")
+		return
+	}
+
+	var updated models.TestCase
+	err = h.changeProblem(r, problemID, models.RevisionUpdateTestCase, func() error {
+		var err error
+		updated, err = h.store.UpdateTestCase(testCase)
+		return err
+	})
+	if errors.Is(err, data.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "Test case not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update test case")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// DeleteTestCase removes a test case from a problem. Finished submissions
+// keep their results until they are rejudged.
+func (h *Handler) DeleteTestCase(w http.ResponseWriter, r *http.Request) {
+	problemID, testCaseID, err := parseTestCasePath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.changeProblem(r, problemID, models.RevisionDeleteTestCase, func() error {
+		return h.store.DeleteTestCase(problemID, testCaseID)
+	})
+	if errors.Is(err, data.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "Test case not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete test case")
+		return
+	}
+
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// hasSubtask reports whether a problem defines the subtask with the given ID
+func hasSubtask(problem models.Problem, subtaskID int) bool {
+	for _, st := range problem.Subtasks {
+		if st.ID == subtaskID {
+			return true
+		}
+	}
+	return false
+}
+
 // SubmitSolution handles a code submission
 func (h *Handler) SubmitSolution(w http.ResponseWriter, r *http.Request) {
 	problemID, err := parseID(r)
@@ -194,9 +435,11 @@ func (h *Handler) SubmitSolution(w http.ResponseWriter, r *http.Request) {
 
 	// Extract submission data
 	var submission struct {
-		UserID   int    `json:"user_id"`
-		Code     string `json:"code"`
-		Language string `json:"language"`
+		UserID          int    `json:"user_id"`
+		Code            string `json:"code"`
+		Language        string `json:"language"`
+		CompilerProfile string `json:"compiler_profile"`
+		Debug           bool   `json:"debug"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
@@ -213,38 +456,85 @@ func (h *Handler) SubmitSolution(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Code is required")
 		return
 	}
-	if submission.Language == "" {
-		submission.Language = "cpp" // Default to C++
+	// Store the canonical language ID; an empty language defaults to C++
+	language, ok := sandbox.LookupLanguage(submission.Language)
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported language: %s", submission.Language))
+		return
+	}
+	submission.Language = language.ID
+
+	problem, err := h.store.GetProblemByID(problemID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	// 记录编译配置及其编译选项，便于复现评测环境
+	profile, err := sandbox.SelectCompilerProfile(language, submission.CompilerProfile, problem.CompilerProfiles)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Create submission record
 	newSubmission := models.Submission{
-		UserID:      submission.UserID,
-		ProblemID:   problemID,
-		Code:        submission.Code,
-		Language:    submission.Language,
-		Status:      "Pending",
-		CreatedAt:   time.Now(),
-		SubmittedAt: time.Now(),
+		UserID:          submission.UserID,
+		ProblemID:       problemID,
+		Code:            submission.Code,
+		Language:        submission.Language,
+		CompilerProfile: profile.ID,
+		CompileFlags:    profile.Flags,
+		Debug:           submission.Debug,
+		Status:          "Pending",
+		CreatedAt:       time.Now(),
+		SubmittedAt:     time.Now(),
 	}
 
 	savedSubmission, err := h.store.AddSubmission(newSubmission)
 	if err != nil {
+		// The problem may have been deleted since it was read above
+		if err.Error() == "problem not found" {
+			respondError(w, http.StatusNotFound, "Problem not found")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to save submission")
 		return
 	}
 
-	// Process the submission asynchronously
-	go func() {
-		if err := h.judgeService.EvaluateSubmission(savedSubmission.ID); err != nil {
-			fmt.Printf("Error evaluating submission %d: %v\n", savedSubmission.ID, err)
-		}
-	}()
+	// Queue the submission for asynchronous evaluation
+	position, err := h.judgeQueue.Enqueue(savedSubmission.ID)
+	if err != nil {
+		savedSubmission.Status = judge.StatusInternalError
+		h.store.UpdateSubmission(savedSubmission)
+		respondError(w, http.StatusServiceUnavailable, "Judge is busy, please try again later")
+		return
+	}
 
-	// Return the submission ID and initial status
+	// Return the submission ID, initial status and queue position
 	respondJSON(w, http.StatusAccepted, map[string]interface{}{
-		"submission_id": savedSubmission.ID,
-		"status":        savedSubmission.Status,
+		"submission_id":  savedSubmission.ID,
+		"status":         savedSubmission.Status,
+		"queue_position": position,
+	})
+}
+
+// GetJudgeStats returns the length of the judge queue and the hit rate of
+// the compile cache
+func (h *Handler) GetJudgeStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"queue_length":  h.judgeQueue.Len(),
+		"compile_cache": h.judgeService.CompileCacheStats(),
+	})
+}
+
+// GetLanguages returns the languages submissions may be written in and the
+// compiler profiles available for them
+func (h *Handler) GetLanguages(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"languages":         sandbox.Languages(),
+		"compiler_profiles": sandbox.CompilerProfiles(),
+		"default":           sandbox.DefaultLanguage,
 	})
 }
 
@@ -263,17 +553,147 @@ func (h *Handler) GetSubmission(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get test results if available
-	testResults, _ := h.store.GetTestResultsBySubmissionID(id)
+	testResults, err := h.testVerdicts(submission)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test results")
+		return
+	}
 
-	// Include test results in response
+	// Include test results and the position in the judge queue (0 once judging started)
 	response := map[string]interface{}{
-		"submission":   submission,
-		"test_results": testResults,
+		"submission":     submission,
+		"test_results":   testResults,
+		"queue_position": h.judgeQueue.Position(id),
 	}
 
 	respondJSON(w, http.StatusOK, response)
 }
 
+// GetSubmissionTests returns the per-test verdicts of a submission
+func (h *Handler) GetSubmissionTests(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	submission, err := h.store.GetSubmissionByID(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	testResults, err := h.testVerdicts(submission)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test results")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, testResults)
+}
+
+// verdictTextLimit caps inputs and outputs shown for example tests, in bytes
+const verdictTextLimit = 1024
+
+// testVerdict is the public view of a test result. Inputs and outputs are
+// only included for example tests, so hidden test data never leaves the server.
+type testVerdict struct {
+	Index          int         `json:"index"` // Position among the problem's test cases, from 1
+	TestCaseID     int         `json:"test_case_id"`
+	Subtask        int         `json:"subtask,omitempty"`
+	Status         string      `json:"status"`
+	RunTime        int         `json:"run_time"`  // CPU time in milliseconds
+	WallTime       int         `json:"wall_time"` // In milliseconds
+	Memory         int         `json:"memory"`    // In kilobytes
+	Signal         string      `json:"signal,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	IsExample      bool        `json:"is_example"`
+	Input          string      `json:"input,omitempty"`
+	ExpectedOutput string      `json:"expected_output,omitempty"`
+	Output         string      `json:"output,omitempty"`
+	Diff           *outputDiff `json:"diff,omitempty"`
+}
+
+// outputDiff is the first line on which the output differs from the answer
+type outputDiff struct {
+	Line     int    `json:"line"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// testVerdicts builds the per-test verdicts of a submission in test case order
+func (h *Handler) testVerdicts(submission models.Submission) ([]testVerdict, error) {
+	results, err := h.store.GetTestResultsBySubmissionID(submission.ID)
+	if err != nil {
+		return nil, err
+	}
+	testCases, err := h.store.GetTestCasesByProblemID(submission.ProblemID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results are stored in the order the test cases were run
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	verdicts := make([]testVerdict, 0, len(results))
+	for _, result := range results {
+		verdicts = append(verdicts, newTestVerdict(result, testCases))
+	}
+
+	return verdicts, nil
+}
+
+// newTestVerdict builds the public view of a test result from the problem's test cases
+func newTestVerdict(result models.TestResult, testCases []models.TestCase) testVerdict {
+	verdict := testVerdict{
+		TestCaseID: result.TestCaseID,
+		Status:     result.Status,
+		RunTime:    result.RunTime,
+		WallTime:   result.WallTime,
+		Memory:     result.Memory,
+		Signal:     result.Signal,
+		Message:    result.Message,
+	}
+
+	for i, tc := range testCases {
+		if tc.ID != result.TestCaseID {
+			continue
+		}
+
+		verdict.Index = i + 1
+		verdict.Subtask = tc.Subtask
+		verdict.IsExample = tc.IsExample
+
+		if tc.IsExample {
+			verdict.Input = truncateText(tc.Input, verdictTextLimit)
+			verdict.ExpectedOutput = truncateText(tc.Output, verdictTextLimit)
+			verdict.Output = truncateText(result.Output, verdictTextLimit)
+			if result.Status == judge.StatusWrongAnswer {
+				if line, expected, actual, found := sandbox.FirstDifference(tc.Output, result.Output); found {
+					verdict.Diff = &outputDiff{
+						Line:     line,
+						Expected: truncateText(expected, verdictTextLimit),
+						Actual:   truncateText(actual, verdictTextLimit),
+					}
+				}
+			}
+		}
+		break
+	}
+
+	return verdict
+}
+
+// truncateText shortens s to at most limit bytes without splitting a character
+func truncateText(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "") + "..."
+}
+
 // RegisterUser registers a new user
 func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
@@ -342,6 +762,8 @@ func (h *Handler) ImportProblems(w http.ResponseWriter, r *http.Request) {
 			Difficulty  string `json:"difficulty"`
 			TimeLimit   int    `json:"time_limit"`
 			MemoryLimit int    `json:"memory_limit"`
+			IOMode      string `json:"io_mode"`
+			IOFileName  string `json:"io_file_name"`
 			TestCases   []struct {
 				Input     string `json:"input"`
 				Output    string `json:"output"`
@@ -379,13 +801,20 @@ func (h *Handler) ImportProblems(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// 创建问题
-		problems = append(problems, models.Problem{
+		problem := models.Problem{
 			Title:       p.Title,
 			Description: p.Description,
 			Difficulty:  p.Difficulty,
 			TimeLimit:   timeLimit,
 			MemoryLimit: memoryLimit,
-		})
+			IOMode:      p.IOMode,
+			IOFileName:  p.IOFileName,
+		}
+		if err := validateProblemSettings(problem); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid problem %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		problems = append(problems, problem)
 
 		// 创建测试用例
 		cases := make([]models.TestCase, 0, len(p.TestCases))
@@ -400,7 +829,9 @@ func (h *Handler) ImportProblems(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 执行批量导入
-	importedIDs, err := h.store.ImportProblems(problems, testCases)
+	importedIDs, err := h.createProblems(r, func() ([]int, error) {
+		return h.store.ImportProblems(problems, testCases)
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to import problems: %v", err), http.StatusInternalServerError)
 		return
@@ -589,7 +1020,7 @@ func (h *Handler) GetProblemWithStatus(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, result)
 }
 
-// UpdateProblem 更新题目信息
+// UpdateProblem 更新题目信息，请求体为完整的题目
 func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 	// 解析题目ID
 	problemID, err := parseID(r)
@@ -599,8 +1030,7 @@ func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 检查题目是否存在
-	_, err = h.store.GetProblemByID(problemID)
-	if err != nil {
+	if _, err := h.store.GetProblemByID(problemID); err != nil {
 		respondError(w, http.StatusNotFound, "题目不存在")
 		return
 	}
@@ -612,11 +1042,44 @@ func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if updatedProblem.Title == "" || updatedProblem.Description == "" {
+		respondError(w, http.StatusBadRequest, "Title and description are required")
+		return
+	}
+	if err := validateProblemSettings(updatedProblem); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if updatedProblem.TimeLimit == 0 {
+		updatedProblem.TimeLimit = 1000 // 1 second
+	}
+	if updatedProblem.MemoryLimit == 0 {
+		updatedProblem.MemoryLimit = 128000 // 128 MB
+	}
+
+	// 现有测试用例所属的子任务必须仍然存在
+	testCases, err := h.store.GetTestCasesByProblemID(problemID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve test cases")
+		return
+	}
+	for _, tc := range testCases {
+		if tc.Subtask != 0 && !hasSubtask(updatedProblem, tc.Subtask) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("test case %d belongs to subtask %d, which would no longer exist", tc.ID, tc.Subtask))
+			return
+		}
+	}
+
 	// 确保ID匹配
 	updatedProblem.ID = problemID
 
-	// 更新题目
-	problem, err := h.store.AddProblem(updatedProblem)
+	// 更新题目，并记录修订
+	var problem models.Problem
+	err = h.changeProblem(r, problemID, models.RevisionUpdate, func() error {
+		var err error
+		problem, err = h.store.UpdateProblem(updatedProblem)
+		return err
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "更新题目失败")
 		return
@@ -625,6 +1088,31 @@ func (h *Handler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, problem)
 }
 
+// DeleteProblem 删除题目及其测试用例、提交和用户解题状态。
+// 题目仍有等待或正在评测的提交时拒绝删除，检查与删除在存储中原子地完成
+func (h *Handler) DeleteProblem(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.store.DeleteProblem(problemID)
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		respondError(w, http.StatusNotFound, "题目不存在")
+		return
+	case errors.Is(err, db.ErrProblemJudging):
+		respondError(w, http.StatusConflict, "题目还有正在评测的提交，请稍后再试")
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "删除题目失败")
+		return
+	}
+
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
 // ParseOutline 解析大纲文件并生成题目
 func (h *Handler) ParseOutline(w http.ResponseWriter, r *http.Request) {
 	// 解析大纲文件
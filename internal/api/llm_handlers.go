@@ -231,33 +231,41 @@ func (h *Handler) SaveGeneratedProblem(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:         time.Now(),
 	}
 
-	// 添加到数据存储
-	savedProblem, err := h.store.AddProblem(problem)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "保存问题失败: "+err.Error())
-		return
-	}
-
-	// 添加测试用例
-	for i, tc := range genProblem.TestCases {
-		testCase := models.TestCase{
-			ProblemID: savedProblem.ID,
-			Input:     tc.Input,
-			Output:    tc.Output,
-			IsExample: true, // 默认为示例测试用例
-		}
-
-		// 只将前两个测试用例设为示例
-		if i >= 2 {
-			testCase.IsExample = false
+	// 添加到数据存储，连同测试用例一起记录为题目的第一个修订
+	var savedProblem models.Problem
+	_, err := h.createProblems(r, func() ([]int, error) {
+		var err error
+		savedProblem, err = h.store.AddProblem(problem)
+		if err != nil {
+			return nil, err
 		}
 
-		// 添加到数据存储
-		_, err := h.store.AddTestCase(testCase)
-		if err != nil {
-			log.Printf("添加测试用例失败: %v", err)
-			// 继续添加其他测试用例，不中断流程
+		// 添加测试用例
+		for i, tc := range genProblem.TestCases {
+			testCase := models.TestCase{
+				ProblemID: savedProblem.ID,
+				Input:     tc.Input,
+				Output:    tc.Output,
+				IsExample: true, // 默认为示例测试用例
+			}
+
+			// 只将前两个测试用例设为示例
+			if i >= 2 {
+				testCase.IsExample = false
+			}
+
+			// 添加到数据存储
+			_, err := h.store.AddTestCase(testCase)
+			if err != nil {
+				log.Printf("添加测试用例失败: %v", err)
+				// 继续添加其他测试用例，不中断流程
+			}
 		}
+		return []int{savedProblem.ID}, nil
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "保存问题失败: "+err.Error())
+		return
 	}
 
 	// 返回保存的问题
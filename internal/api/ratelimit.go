@@ -0,0 +1,58 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each user at most limit events per sliding window. It is
+// safe for concurrent use.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[int][]time.Time // by user ID, oldest first
+}
+
+// newRateLimiter creates a limiter allowing limit events per window
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[int][]time.Time),
+	}
+}
+
+// Allow records an event for the user if it is within the limit. Otherwise
+// it returns false and how long to wait until the next event is allowed.
+func (l *rateLimiter) Allow(userID int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	events := l.events[userID]
+	if len(events) >= l.limit {
+		return false, events[0].Add(l.window).Sub(now)
+	}
+
+	l.events[userID] = append(events, now)
+	return true, 0
+}
+
+// prune forgets events that left the window; l.mu must be held
+func (l *rateLimiter) prune(now time.Time) {
+	cutoff := now.Add(-l.window)
+	for userID, events := range l.events {
+		i := 0
+		for i < len(events) && !events[i].After(cutoff) {
+			i++
+		}
+		if i == len(events) {
+			delete(l.events, userID)
+		} else if i > 0 {
+			l.events[userID] = events[i:]
+		}
+	}
+}
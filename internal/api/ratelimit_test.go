@@ -0,0 +1,95 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// allowN calls Allow n times for a user and returns how many were allowed
+func allowN(l *rateLimiter, userID, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := l.Allow(userID); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	const window = time.Minute
+	l := newRateLimiter(3, window)
+
+	if allowed := allowN(l, 1, 3); allowed != 3 {
+		t.Fatalf("allowed %d of a burst of 3, want 3", allowed)
+	}
+
+	ok, wait := l.Allow(1)
+	if ok {
+		t.Fatal("fourth event in the window was allowed")
+	}
+	if wait <= 0 || wait > window {
+		t.Errorf("wait = %v, want within (0, %v]", wait, window)
+	}
+
+	// Refused events do not count against the user
+	if events := len(l.events[1]); events != 3 {
+		t.Errorf("recorded %d events, want 3", events)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	const window = 200 * time.Millisecond
+	l := newRateLimiter(2, window)
+
+	start := time.Now()
+	allowN(l, 1, 1)
+	time.Sleep(window / 2)
+	allowN(l, 1, 1)
+
+	// The window is sliding: the first event leaves it before the second
+	ok, wait := l.Allow(1)
+	if ok {
+		t.Fatal("third event in the window was allowed")
+	}
+	if elapsed := time.Since(start); wait > window-elapsed+10*time.Millisecond {
+		t.Errorf("wait = %v, want about the first event's remaining %v", wait, window-elapsed)
+	}
+
+	time.Sleep(wait + 10*time.Millisecond)
+	if ok, _ := l.Allow(1); !ok {
+		t.Error("event after the first one left the window was refused")
+	}
+	if ok, _ := l.Allow(1); ok {
+		t.Error("event allowed while the second and third are still in the window")
+	}
+
+	// After a whole window without events the full burst is available
+	time.Sleep(window + 10*time.Millisecond)
+	if allowed := allowN(l, 1, 3); allowed != 2 {
+		t.Errorf("allowed %d events after the window, want 2", allowed)
+	}
+	time.Sleep(window + 10*time.Millisecond)
+	l.Allow(2)
+	if _, ok := l.events[1]; ok {
+		t.Error("events of an idle user were kept")
+	}
+}
+
+func TestRateLimiterUsersAreSeparate(t *testing.T) {
+	l := newRateLimiter(2, time.Minute)
+
+	if allowed := allowN(l, 1, 5); allowed != 2 {
+		t.Fatalf("user 1: allowed %d of 5, want 2", allowed)
+	}
+	// User 1 using up the limit leaves the others' untouched
+	if allowed := allowN(l, 2, 2); allowed != 2 {
+		t.Errorf("user 2: allowed %d of 2, want 2", allowed)
+	}
+	if ok, _ := l.Allow(2); ok {
+		t.Error("user 2: third event allowed")
+	}
+	if allowed := allowN(l, 3, 1); allowed != 1 {
+		t.Errorf("user 3: allowed %d of 1, want 1", allowed)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/user/cppjudge/internal/db"
+	"github.com/user/cppjudge/internal/judge"
+	"github.com/user/cppjudge/internal/models"
+)
+
+// RejudgeSubmission clears the results of a finished submission and queues
+// it for evaluation again
+func (h *Handler) RejudgeSubmission(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	submission, err := h.store.GetSubmissionByID(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+	if submission.Status == judge.StatusPending || submission.Status == judge.StatusTesting {
+		respondError(w, http.StatusConflict, judge.ErrSubmissionJudging.Error())
+		return
+	}
+
+	h.rejudge(w, []int{id})
+}
+
+// RejudgeProblem queues all finished submissions of a problem for evaluation
+// again, optionally only those whose status is in the request's statuses. With
+// reload_test_cases the problem's test cases are first re-read from the data
+// file, so that corrected expected outputs take effect.
+func (h *Handler) RejudgeProblem(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.store.GetProblemByID(problemID); err != nil {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	// The body is optional; without it every submission is rejudged
+	var request struct {
+		Statuses        []string `json:"statuses"`
+		ReloadTestCases bool     `json:"reload_test_cases"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if request.ReloadTestCases {
+		err := h.changeProblem(r, problemID, models.RevisionReload, func() error {
+			_, err := h.store.ReloadTestCases(problemID)
+			return err
+		})
+		if errors.Is(err, db.ErrReloadUnsupported) {
+			respondError(w, http.StatusBadRequest, "reload_test_cases is only available with DB_DRIVER=memory; update the test cases through the API instead")
+			return
+		} else if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reload test cases: %v", err))
+			return
+		}
+	}
+	statuses := make(map[string]bool, len(request.Statuses))
+	for _, status := range request.Statuses {
+		statuses[status] = true
+	}
+
+	submissions := h.store.GetSubmissionsByProblemID(problemID)
+	ids := make([]int, 0, len(submissions))
+	for _, submission := range submissions {
+		if len(statuses) == 0 || statuses[submission.Status] {
+			ids = append(ids, submission.ID)
+		}
+	}
+
+	h.rejudge(w, ids)
+}
+
+// rejudge queues the given submissions and reports which of them were
+// queued; the others were still being judged
+func (h *Handler) rejudge(w http.ResponseWriter, ids []int) {
+	queued, err := h.judgeQueue.Rejudge(ids)
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Judge is busy, please try again later")
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"submission_ids": queued,
+		"queued":         len(queued),
+		"skipped":        len(ids) - len(queued),
+	})
+}
@@ -0,0 +1,517 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/cppjudge/internal/models"
+)
+
+// revisionIgnoredFields are the JSON fields left out of revision diffs: IDs
+// and timestamps change without the problem changing
+var revisionIgnoredFields = map[string]bool{
+	"id":         true,
+	"problem_id": true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// revisionSummary is a revision without its snapshot, as listed
+type revisionSummary struct {
+	ID           int                     `json:"id"`
+	Revision     int                     `json:"revision"`
+	Action       string                  `json:"action"`
+	AuthorID     int                     `json:"author_id,omitempty"`
+	RestoredFrom int                     `json:"restored_from,omitempty"`
+	Changes      []models.RevisionChange `json:"changes"`
+	CreatedAt    time.Time               `json:"created_at"`
+}
+
+// redactRevision returns the snapshot of a revision as shown to users, like a
+// problem's page: only its example test cases, and without the checker,
+// interactor and reference solution. Its changes are left out; they are
+// recomputed between redacted snapshots by publicRevisions.
+func redactRevision(revision models.ProblemRevision) models.ProblemRevision {
+	revision.Problem.ReferenceSolution = ""
+	revision.Problem.Checker = ""
+	revision.Problem.Interactor = ""
+
+	examples := make([]models.TestCase, 0, len(revision.TestCases))
+	for _, tc := range revision.TestCases {
+		if tc.IsExample {
+			examples = append(examples, tc)
+		}
+	}
+	revision.TestCases = examples
+	revision.Changes = []models.RevisionChange{}
+	return revision
+}
+
+// publicRevisions redacts consecutive revisions of a problem, oldest first,
+// and recomputes their changes between the redacted snapshots, so that a
+// change to a hidden test case or a secret field shows nothing of it. previous
+// is the revision before the first one, or nil if there is none.
+func publicRevisions(previous *models.ProblemRevision, revisions []models.ProblemRevision) ([]models.ProblemRevision, error) {
+	public := make([]models.ProblemRevision, 0, len(revisions))
+	var from *models.ProblemRevision
+	if previous != nil {
+		redacted := redactRevision(*previous)
+		from = &redacted
+	}
+	for _, revision := range revisions {
+		redacted := redactRevision(revision)
+		if from != nil {
+			changes, err := diffRevisions(*from, redacted)
+			if err != nil {
+				return nil, err
+			}
+			redacted.Changes = changes
+		}
+		public = append(public, redacted)
+		from = &redacted
+	}
+	return public, nil
+}
+
+// publicRevision redacts a revision, with its changes from the revision
+// before it
+func (h *Handler) publicRevision(revision models.ProblemRevision) (models.ProblemRevision, error) {
+	var previous *models.ProblemRevision
+	if revision.Revision > 1 {
+		before, err := h.store.GetProblemRevision(revision.ProblemID, revision.Revision-1)
+		if err != nil {
+			return models.ProblemRevision{}, err
+		}
+		previous = &before
+	}
+	public, err := publicRevisions(previous, []models.ProblemRevision{revision})
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+	return public[0], nil
+}
+
+// revisionAuthor returns the user making a change, given by the optional
+// user_id query parameter, or 0 if unknown
+func revisionAuthor(r *http.Request) int {
+	authorID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || authorID < 0 {
+		return 0
+	}
+	return authorID
+}
+
+// snapshotProblem reads the current state of a problem and its test cases
+func (h *Handler) snapshotProblem(problemID int) (models.Problem, []models.TestCase, error) {
+	problem, err := h.store.GetProblemByID(problemID)
+	if err != nil {
+		return models.Problem{}, nil, err
+	}
+	testCases, err := h.store.GetTestCasesByProblemID(problemID)
+	if err != nil {
+		return models.Problem{}, nil, err
+	}
+	return problem, testCases, nil
+}
+
+// changeProblem makes a change to an existing problem and records it as a
+// revision. The judge's problem lock is held throughout, so that concurrent
+// changes are recorded one by one, each credited to its author, and no
+// submission reads the problem between the change and its revision. A
+// problem from before revisions were kept first gets a baseline revision.
+// change's error is returned; failing to record the revision is only logged,
+// as the change has been made by then.
+func (h *Handler) changeProblem(r *http.Request, problemID int, action string, change func() error) error {
+	return h.judgeService.ChangeProblem(func() error {
+		h.ensureBaselineRevision(problemID)
+		if err := change(); err != nil {
+			return err
+		}
+		if _, err := h.recordRevision(r, problemID, action, 0); err != nil {
+			log.Printf("记录题目 %d 的修订失败: %v", problemID, err)
+		}
+		return nil
+	})
+}
+
+// createProblems runs create, which adds problems and returns their IDs, and
+// records the first revision of each under the judge's problem lock
+func (h *Handler) createProblems(r *http.Request, create func() ([]int, error)) ([]int, error) {
+	var ids []int
+	err := h.judgeService.ChangeProblem(func() error {
+		var err error
+		if ids, err = create(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if _, err := h.recordRevision(r, id, models.RevisionCreate, 0); err != nil {
+				log.Printf("记录题目 %d 的修订失败: %v", id, err)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// ensureBaselineRevision records the current state of a problem created
+// before revisions were kept, so that its first change can be diffed and
+// rolled back. It must be called before the change is made, with the judge's
+// problem lock held.
+func (h *Handler) ensureBaselineRevision(problemID int) {
+	latest, err := h.store.GetLatestProblemRevision(problemID)
+	if err != nil || latest > 0 {
+		return
+	}
+	problem, testCases, err := h.snapshotProblem(problemID)
+	if err != nil {
+		return
+	}
+	if _, err := h.store.AddProblemRevision(models.ProblemRevision{
+		ProblemID: problemID,
+		Action:    models.RevisionBaseline,
+		Problem:   problem,
+		TestCases: testCases,
+		Changes:   []models.RevisionChange{},
+	}); err != nil {
+		log.Printf("记录题目 %d 的初始修订失败: %v", problemID, err)
+	}
+}
+
+// recordRevision records the current state of a problem as a new revision,
+// with its changes from the latest one. Nothing is recorded when nothing
+// changed; the latest revision is returned then. The judge's problem lock
+// must be held since before the change was made.
+func (h *Handler) recordRevision(r *http.Request, problemID int, action string, restoredFrom int) (models.ProblemRevision, error) {
+	problem, testCases, err := h.snapshotProblem(problemID)
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+
+	revision := models.ProblemRevision{
+		ProblemID:    problemID,
+		Action:       action,
+		AuthorID:     revisionAuthor(r),
+		RestoredFrom: restoredFrom,
+		Problem:      problem,
+		TestCases:    testCases,
+		Changes:      []models.RevisionChange{},
+	}
+
+	latest, err := h.store.GetLatestProblemRevision(problemID)
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+	if latest > 0 {
+		previous, err := h.store.GetProblemRevision(problemID, latest)
+		if err != nil {
+			return models.ProblemRevision{}, err
+		}
+		revision.Changes, err = diffRevisions(previous, revision)
+		if err != nil {
+			return models.ProblemRevision{}, err
+		}
+		if len(revision.Changes) == 0 {
+			return previous, nil
+		}
+	}
+
+	return h.store.AddProblemRevision(revision)
+}
+
+// diffRevisions lists the changes between two snapshots of a problem: its
+// changed fields, then its test cases by ID, each added, removed or with its
+// changed fields
+func diffRevisions(from, to models.ProblemRevision) ([]models.RevisionChange, error) {
+	changes, err := diffFields(0, from.Problem, to.Problem)
+	if err != nil {
+		return nil, err
+	}
+
+	fromCases := make(map[int]models.TestCase, len(from.TestCases))
+	for _, tc := range from.TestCases {
+		fromCases[tc.ID] = tc
+	}
+	toCases := make(map[int]models.TestCase, len(to.TestCases))
+	for _, tc := range to.TestCases {
+		toCases[tc.ID] = tc
+	}
+
+	ids := make([]int, 0, len(fromCases)+len(toCases))
+	for id := range fromCases {
+		ids = append(ids, id)
+	}
+	for id := range toCases {
+		if _, ok := fromCases[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		oldCase, hadCase := fromCases[id]
+		newCase, hasCase := toCases[id]
+		switch {
+		case !hadCase:
+			changes = append(changes, models.RevisionChange{TestCaseID: id, Change: models.ChangeAdded, New: newCase})
+		case !hasCase:
+			changes = append(changes, models.RevisionChange{TestCaseID: id, Change: models.ChangeRemoved, Old: oldCase})
+		default:
+			caseChanges, err := diffFields(id, oldCase, newCase)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, caseChanges...)
+		}
+	}
+
+	return changes, nil
+}
+
+// diffFields compares two values field by field through their JSON form
+func diffFields(testCaseID int, from, to interface{}) ([]models.RevisionChange, error) {
+	fromFields, err := jsonFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := jsonFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(fromFields)+len(toFields))
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]models.RevisionChange, 0)
+	for _, name := range names {
+		if revisionIgnoredFields[name] || reflect.DeepEqual(fromFields[name], toFields[name]) {
+			continue
+		}
+		changes = append(changes, models.RevisionChange{
+			TestCaseID: testCaseID,
+			Field:      name,
+			Change:     models.ChangeModified,
+			Old:        fromFields[name],
+			New:        toFields[name],
+		})
+	}
+	return changes, nil
+}
+
+// jsonFields returns the fields of a value as encoded in JSON
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+// parseRevisionPath extracts the problem ID and, if present, the revision
+// number from a /api/problems/{id}/revisions[/{revision}[/rollback]] or
+// /api/problems/{id}/revisions/diff path
+func parseRevisionPath(r *http.Request) (int, int, error) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/problems/"), "/")
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) < 2 || pathParts[1] != "revisions" {
+		return 0, 0, errors.New("missing ID parameter")
+	}
+
+	problemID, err := strconv.Atoi(pathParts[0])
+	if err != nil {
+		return 0, 0, errors.New("invalid ID parameter")
+	}
+	if len(pathParts) < 3 || pathParts[2] == "diff" {
+		return problemID, 0, nil
+	}
+	revision, err := strconv.Atoi(pathParts[2])
+	if err != nil || revision < 1 {
+		return 0, 0, errors.New("invalid revision parameter")
+	}
+
+	return problemID, revision, nil
+}
+
+// GetProblemRevisions lists the revisions of a problem, oldest first, without
+// their snapshots. Changes to hidden test cases and secret fields are left out.
+func (h *Handler) GetProblemRevisions(w http.ResponseWriter, r *http.Request) {
+	problemID, _, err := parseRevisionPath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.store.GetProblemByID(problemID); err != nil {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	revisions, err := h.store.GetProblemRevisions(problemID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve revisions")
+		return
+	}
+	revisions, err = publicRevisions(nil, revisions)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to diff revisions")
+		return
+	}
+
+	summaries := make([]revisionSummary, 0, len(revisions))
+	for _, revision := range revisions {
+		summaries = append(summaries, revisionSummary{
+			ID:           revision.ID,
+			Revision:     revision.Revision,
+			Action:       revision.Action,
+			AuthorID:     revision.AuthorID,
+			RestoredFrom: revision.RestoredFrom,
+			Changes:      revision.Changes,
+			CreatedAt:    revision.CreatedAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, summaries)
+}
+
+// GetProblemRevision returns a revision of a problem with its snapshot,
+// redacted like a problem's page
+func (h *Handler) GetProblemRevision(w http.ResponseWriter, r *http.Request) {
+	problemID, revisionNumber, err := parseRevisionPath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revision, err := h.store.GetProblemRevision(problemID, revisionNumber)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+	revision, err = h.publicRevision(revision)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to diff revisions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, revision)
+}
+
+// DiffProblemRevisions lists the changes between two revisions of a problem,
+// given by the from and to query parameters. to defaults to the latest
+// revision and from to the one before to. Like the revisions themselves, the
+// changes leave out hidden test cases and secret fields.
+func (h *Handler) DiffProblemRevisions(w http.ResponseWriter, r *http.Request) {
+	problemID, _, err := parseRevisionPath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	latest, err := h.store.GetLatestProblemRevision(problemID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retrieve revisions")
+		return
+	}
+
+	query := r.URL.Query()
+	to := latest
+	if value := query.Get("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid to parameter")
+			return
+		}
+	}
+	from := to - 1
+	if value := query.Get("from"); value != "" {
+		if from, err = strconv.Atoi(value); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid from parameter")
+			return
+		}
+	}
+
+	fromRevision, err := h.store.GetProblemRevision(problemID, from)
+	if err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Revision %d not found", from))
+		return
+	}
+	toRevision, err := h.store.GetProblemRevision(problemID, to)
+	if err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Revision %d not found", to))
+		return
+	}
+
+	changes, err := diffRevisions(redactRevision(fromRevision), redactRevision(toRevision))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to diff revisions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"changes": changes,
+	})
+}
+
+// RollbackProblem restores a problem and its test cases to an earlier
+// revision, recorded as a new revision. Finished submissions keep their
+// results until they are rejudged.
+func (h *Handler) RollbackProblem(w http.ResponseWriter, r *http.Request) {
+	problemID, revisionNumber, err := parseRevisionPath(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target, err := h.store.GetProblemRevision(problemID, revisionNumber)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	// The problem and its test cases are restored together, and the rollback
+	// recorded before any other change or submission sees them
+	var revision models.ProblemRevision
+	var recordErr error
+	err = h.judgeService.ChangeProblem(func() error {
+		problem := target.Problem
+		problem.ID = problemID
+		if _, _, err := h.store.RestoreProblem(problem, target.TestCases); err != nil {
+			return err
+		}
+		revision, recordErr = h.recordRevision(r, problemID, models.RevisionRollback, revisionNumber)
+		return nil
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to restore problem")
+		return
+	}
+	if recordErr != nil {
+		log.Printf("记录题目 %d 的修订失败: %v", problemID, recordErr)
+		respondError(w, http.StatusInternalServerError, "Problem restored, but failed to record the revision")
+		return
+	}
+	if revision, err = h.publicRevision(revision); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to diff revisions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, revision)
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/cppjudge/internal/db"
+	"github.com/user/cppjudge/internal/judge"
+	"github.com/user/cppjudge/internal/models"
+)
+
+// newTestServer serves the API from a memory store whose data files are kept
+// in a temporary working directory. Nothing is judged.
+func newTestServer(t *testing.T) (http.Handler, db.Store) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	store := db.NewMemoryStore()
+	return SetupRoutes(NewHandler(store, judge.NewJudge(store, nil), nil)), store
+}
+
+// doJSON sends a request with a JSON body, if any, and checks its status
+func doJSON(t *testing.T, server http.Handler, method, path string, body interface{}, wantStatus int) []byte {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, path, reader))
+	if recorder.Code != wantStatus {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, recorder.Code, wantStatus, recorder.Body.String())
+	}
+	return recorder.Body.Bytes()
+}
+
+// TestRevisionsHideSecrets checks that no revision response shows a hidden
+// test case or the checker, interactor or reference solution, whichever
+// revisions are read or compared
+func TestRevisionsHideSecrets(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var problem models.Problem
+	body := doJSON(t, server, http.MethodPost, "/api/problems?user_id=1", map[string]interface{}{
+		"title":              "A+B",
+		"description":        "Add two numbers",
+		"reference_solution": "SECRET-SOLUTION",
+		"checker":            "SECRET-CHECKER-1",
+	}, http.StatusCreated)
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatal(err)
+	}
+	base := fmt.Sprintf("/api/problems/%d", problem.ID)
+
+	doJSON(t, server, http.MethodPost, base+"/testcases", models.TestCase{Input: "1 2\n", Output: "3\n", IsExample: true}, http.StatusCreated)
+	var hidden models.TestCase
+	body = doJSON(t, server, http.MethodPost, base+"/testcases", models.TestCase{Input: "HIDDEN-INPUT-1\n", Output: "HIDDEN-OUTPUT-1\n"}, http.StatusCreated)
+	if err := json.Unmarshal(body, &hidden); err != nil {
+		t.Fatal(err)
+	}
+	doJSON(t, server, http.MethodPut, fmt.Sprintf("%s/testcases/%d", base, hidden.ID),
+		models.TestCase{Input: "HIDDEN-INPUT-2\n", Output: "HIDDEN-OUTPUT-2\n"}, http.StatusOK)
+	doJSON(t, server, http.MethodPut, base, map[string]interface{}{
+		"title":              "A+B again",
+		"description":        "Add two numbers",
+		"reference_solution": "SECRET-SOLUTION-2",
+		"checker":            "SECRET-CHECKER-2",
+	}, http.StatusOK)
+	doJSON(t, server, http.MethodDelete, fmt.Sprintf("%s/testcases/%d", base, hidden.ID), nil, http.StatusNoContent)
+
+	var responses [][]byte
+	responses = append(responses, doJSON(t, server, http.MethodPost, base+"/revisions/3/rollback", nil, http.StatusOK))
+
+	body = doJSON(t, server, http.MethodGet, base+"/revisions", nil, http.StatusOK)
+	responses = append(responses, body)
+	var summaries []revisionSummary
+	if err := json.Unmarshal(body, &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 7 {
+		t.Fatalf("got %d revisions, want 7", len(summaries))
+	}
+
+	for from := 1; from <= len(summaries); from++ {
+		responses = append(responses, doJSON(t, server, http.MethodGet, fmt.Sprintf("%s/revisions/%d", base, from), nil, http.StatusOK))
+		for to := 1; to <= len(summaries); to++ {
+			responses = append(responses, doJSON(t, server, http.MethodGet,
+				fmt.Sprintf("%s/revisions/diff?from=%d&to=%d", base, from, to), nil, http.StatusOK))
+		}
+	}
+
+	for _, response := range responses {
+		for _, secret := range []string{"HIDDEN", "SECRET"} {
+			if strings.Contains(string(response), secret) {
+				t.Errorf("response shows %s data: %s", secret, response)
+			}
+		}
+	}
+
+	// The example test case and public fields still show
+	body = doJSON(t, server, http.MethodGet, base+"/revisions/4", nil, http.StatusOK)
+	var revision models.ProblemRevision
+	if err := json.Unmarshal(body, &revision); err != nil {
+		t.Fatal(err)
+	}
+	if revision.Problem.Title != "A+B" || len(revision.TestCases) != 1 || revision.TestCases[0].Input != "1 2\n" {
+		t.Errorf("revision 4 = %+v, want the problem with its example only", revision)
+	}
+	body = doJSON(t, server, http.MethodGet, base+"/revisions/5", nil, http.StatusOK)
+	if err := json.Unmarshal(body, &revision); err != nil {
+		t.Fatal(err)
+	}
+	if len(revision.Changes) != 1 || revision.Changes[0].Field != "title" {
+		t.Errorf("revision 5 changes = %+v, want the title only", revision.Changes)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	problem := models.Problem{ID: 1, Title: "A+B", Description: "Add two numbers", TimeLimit: 1000, MemoryLimit: 65536}
+	example := models.TestCase{ID: 1, ProblemID: 1, Input: "1 2\n", Output: "3\n", IsExample: true}
+	hidden := models.TestCase{ID: 2, ProblemID: 1, Input: "2 2\n", Output: "4\n"}
+
+	retitled := problem
+	retitled.Title = "A+B again"
+	retitled.TimeLimit = 2000
+	touched := problem
+	touched.UpdatedAt = touched.UpdatedAt.Add(time.Hour)
+	changedHidden := hidden
+	changedHidden.Output = "5\n"
+	changedHidden.Subtask = 1
+	moved := hidden
+	moved.ProblemID = 2
+
+	tests := []struct {
+		name     string
+		from, to models.ProblemRevision
+		want     []models.RevisionChange
+	}{
+		{
+			name: "unchanged",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, hidden}},
+			to:   models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{hidden, example}},
+			want: []models.RevisionChange{},
+		},
+		{
+			name: "problem fields changed",
+			from: models.ProblemRevision{Problem: problem},
+			to:   models.ProblemRevision{Problem: retitled},
+			want: []models.RevisionChange{
+				{Field: "time_limit", Change: models.ChangeModified, Old: float64(1000), New: float64(2000)},
+				{Field: "title", Change: models.ChangeModified, Old: "A+B", New: "A+B again"},
+			},
+		},
+		{
+			name: "IDs and timestamps ignored",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{hidden}},
+			to:   models.ProblemRevision{Problem: touched, TestCases: []models.TestCase{moved}},
+			want: []models.RevisionChange{},
+		},
+		{
+			name: "test case added",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example}},
+			to:   models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, hidden}},
+			want: []models.RevisionChange{{TestCaseID: 2, Change: models.ChangeAdded, New: hidden}},
+		},
+		{
+			name: "test case removed",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, hidden}},
+			to:   models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{hidden}},
+			want: []models.RevisionChange{{TestCaseID: 1, Change: models.ChangeRemoved, Old: example}},
+		},
+		{
+			name: "test case changed",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, hidden}},
+			to:   models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, changedHidden}},
+			want: []models.RevisionChange{
+				{TestCaseID: 2, Field: "output", Change: models.ChangeModified, Old: "4\n", New: "5\n"},
+				{TestCaseID: 2, Field: "subtask", Change: models.ChangeModified, Old: nil, New: float64(1)},
+			},
+		},
+		{
+			name: "everything at once",
+			from: models.ProblemRevision{Problem: problem, TestCases: []models.TestCase{example, hidden}},
+			to:   models.ProblemRevision{Problem: retitled, TestCases: []models.TestCase{changedHidden, {ID: 3, Input: "0 0\n", Output: "0\n"}}},
+			want: []models.RevisionChange{
+				{Field: "time_limit", Change: models.ChangeModified, Old: float64(1000), New: float64(2000)},
+				{Field: "title", Change: models.ChangeModified, Old: "A+B", New: "A+B again"},
+				{TestCaseID: 1, Change: models.ChangeRemoved, Old: example},
+				{TestCaseID: 2, Field: "output", Change: models.ChangeModified, Old: "4\n", New: "5\n"},
+				{TestCaseID: 2, Field: "subtask", Change: models.ChangeModified, Old: nil, New: float64(1)},
+				{TestCaseID: 3, Change: models.ChangeAdded, New: models.TestCase{ID: 3, Input: "0 0\n", Output: "0\n"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffRevisions(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("diffRevisions: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffRevisions =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRollbackRestoresRevision rolls a problem back and checks the stored
+// problem and test cases against the revision rolled back to
+func TestRollbackRestoresRevision(t *testing.T) {
+	server, store := newTestServer(t)
+
+	var problem models.Problem
+	body := doJSON(t, server, http.MethodPost, "/api/problems?user_id=1", map[string]interface{}{
+		"title":       "A+B",
+		"description": "Add two numbers",
+		"time_limit":  1000,
+		"checker":     "checker 1",
+	}, http.StatusCreated)
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatal(err)
+	}
+	base := fmt.Sprintf("/api/problems/%d", problem.ID)
+
+	var testCases []models.TestCase
+	for _, tc := range []models.TestCase{
+		{Input: "1 2\n", Output: "3\n", IsExample: true},
+		{Input: "2 2\n", Output: "4\n"},
+	} {
+		var added models.TestCase
+		if err := json.Unmarshal(doJSON(t, server, http.MethodPost, base+"/testcases", tc, http.StatusCreated), &added); err != nil {
+			t.Fatal(err)
+		}
+		testCases = append(testCases, added)
+	}
+
+	// Revision 3 has both test cases; later revisions change the problem,
+	// change one test case, remove the other and add a new one
+	doJSON(t, server, http.MethodPut, base, map[string]interface{}{
+		"title":       "A+B again",
+		"description": "Add two numbers",
+		"time_limit":  2000,
+		"checker":     "checker 2",
+	}, http.StatusOK)
+	doJSON(t, server, http.MethodPut, fmt.Sprintf("%s/testcases/%d", base, testCases[1].ID),
+		models.TestCase{Input: "2 2\n", Output: "5\n"}, http.StatusOK)
+	doJSON(t, server, http.MethodDelete, fmt.Sprintf("%s/testcases/%d", base, testCases[0].ID), nil, http.StatusNoContent)
+	doJSON(t, server, http.MethodPost, base+"/testcases", models.TestCase{Input: "0 0\n", Output: "0\n"}, http.StatusCreated)
+
+	target, err := store.GetProblemRevision(problem.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(target.TestCases) != 2 {
+		t.Fatalf("revision 3 has %d test cases, want 2", len(target.TestCases))
+	}
+
+	var rollback models.ProblemRevision
+	if err := json.Unmarshal(doJSON(t, server, http.MethodPost, base+"/revisions/3/rollback", nil, http.StatusOK), &rollback); err != nil {
+		t.Fatal(err)
+	}
+	if rollback.Action != models.RevisionRollback || rollback.RestoredFrom != 3 {
+		t.Errorf("rollback revision = %+v, want a rollback from revision 3", rollback)
+	}
+
+	restored, err := store.GetProblemByID(problem.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredCases, err := store.GetTestCasesByProblemID(problem.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Checker != "checker 1" {
+		t.Errorf("restored checker %q, want %q", restored.Checker, "checker 1")
+	}
+
+	// Apart from IDs and timestamps, the problem and test cases are those of
+	// revision 3, and the test cases keep their IDs
+	current := models.ProblemRevision{Problem: restored, TestCases: restoredCases}
+	changes, err := diffRevisions(target, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("restored problem differs from revision 3: %+v", changes)
+	}
+	if !reflect.DeepEqual(restoredCases, target.TestCases) {
+		t.Errorf("restored test cases = %+v, want %+v", restoredCases, target.TestCases)
+	}
+}
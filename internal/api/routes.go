@@ -173,9 +173,39 @@ func SetupRoutes(handler *Handler) *http.ServeMux {
 			return
 		}
 
+		// 题目修订记录：列表、详情、比较与回滚
+		if strings.Contains(path, "/revisions") {
+			if strings.HasSuffix(path, "/revisions") && r.Method == http.MethodGet {
+				handler.GetProblemRevisions(w, r)
+			} else if strings.HasSuffix(path, "/revisions/diff") && r.Method == http.MethodGet {
+				handler.DiffProblemRevisions(w, r)
+			} else if strings.HasSuffix(path, "/rollback") && r.Method == http.MethodPost {
+				handler.RollbackProblem(w, r)
+			} else if r.Method == http.MethodGet {
+				handler.GetProblemRevision(w, r)
+			} else {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// 单个测试用例的修改与删除
+		if strings.Contains(path, "/testcases/") {
+			if r.Method == http.MethodPut {
+				handler.UpdateTestCase(w, r)
+			} else if r.Method == http.MethodDelete {
+				handler.DeleteTestCase(w, r)
+			} else {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
 		// Handle testcase routes
 		if strings.HasSuffix(path, "/testcases") {
-			if r.Method == http.MethodPost {
+			if r.Method == http.MethodGet {
+				handler.GetTestCases(w, r)
+			} else if r.Method == http.MethodPost {
 				handler.AddTestCase(w, r)
 			} else {
 				w.WriteHeader(http.StatusMethodNotAllowed)
@@ -193,11 +223,33 @@ func SetupRoutes(handler *Handler) *http.ServeMux {
 			return
 		}
 
+		// 自定义输入运行，不创建提交
+		if strings.HasSuffix(path, "/run") {
+			if r.Method == http.MethodPost {
+				handler.RunCode(w, r)
+			} else {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		// 重测题目的提交，可按评测结果筛选
+		if strings.HasSuffix(path, "/rejudge") {
+			if r.Method == http.MethodPost {
+				handler.RejudgeProblem(w, r)
+			} else {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
 		// Handle problem detail
 		if r.Method == http.MethodGet {
 			handler.GetProblem(w, r)
 		} else if r.Method == http.MethodPut {
 			handler.UpdateProblem(w, r)
+		} else if r.Method == http.MethodDelete {
+			handler.DeleteProblem(w, r)
 		} else {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
@@ -205,13 +257,37 @@ func SetupRoutes(handler *Handler) *http.ServeMux {
 
 	// Submission routes
 	mux.HandleFunc("/api/submissions/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/tests") {
+			handler.GetSubmissionTests(w, r)
+		} else if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/events") {
+			handler.StreamSubmission(w, r)
+		} else if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/rejudge") {
+			handler.RejudgeSubmission(w, r)
+		} else if r.Method == http.MethodGet {
 			handler.GetSubmission(w, r)
 		} else {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
 	})
 
+	// 支持的编程语言
+	mux.HandleFunc("/api/languages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetLanguages(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// 判题队列与编译缓存统计
+	mux.HandleFunc("/api/judge/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetJudgeStats(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
 	// User routes
 	mux.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/user/cppjudge/internal/sandbox"
+)
+
+const (
+	// runRateLimit and runRateWindow bound how often a user may run code
+	runRateLimit  = 10
+	runRateWindow = time.Minute
+	// runInputLimit caps the custom input, in bytes
+	runInputLimit = 1 << 20
+	// runOutputLimit caps stdout and stderr returned to the client, in bytes
+	runOutputLimit = 64 * 1024
+)
+
+// RunCode compiles and runs code on custom input under the problem's limits
+// without creating a submission
+func (h *Handler) RunCode(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseID(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request struct {
+		UserID          int    `json:"user_id"`
+		Code            string `json:"code"`
+		Language        string `json:"language"`
+		CompilerProfile string `json:"compiler_profile"`
+		Input           string `json:"input"`
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*runInputLimit)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Basic validation
+	if request.UserID == 0 {
+		respondError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+	if request.Code == "" {
+		respondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+	language, ok := sandbox.LookupLanguage(request.Language)
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported language: %s", request.Language))
+		return
+	}
+	if len(request.Input) > runInputLimit {
+		respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Input must not exceed %d bytes", runInputLimit))
+		return
+	}
+
+	problem, err := h.store.GetProblemByID(problemID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	profile, err := sandbox.SelectCompilerProfile(language, request.CompilerProfile, problem.CompilerProfiles)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 只为存在的用户计数，避免伪造的 user_id 占用限流器
+	if _, err := h.store.GetUserByID(request.UserID); err != nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if ok, wait := h.runLimiter.Allow(request.UserID); !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		respondError(w, http.StatusTooManyRequests, "Too many runs, please try again later")
+		return
+	}
+
+	// 自定义运行不经过评测队列，限制同时运行的数量
+	select {
+	case h.runSlots <- struct{}{}:
+		defer func() { <-h.runSlots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	result, err := h.judgeService.Run(problem, language, profile.Flags, request.Code, request.Input)
+	if err != nil {
+		log.Printf("自定义运行失败: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to run code")
+		return
+	}
+
+	result.Stdout = truncateText(result.Stdout, runOutputLimit)
+	result.Stderr = truncateText(result.Stderr, runOutputLimit)
+	result.CompileOutput = truncateText(result.CompileOutput, runOutputLimit)
+
+	respondJSON(w, http.StatusOK, result)
+}
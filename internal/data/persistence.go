@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/user/cppjudge/internal/models"
 )
 
 // 默认设置为相对路径，但初始化时会转为绝对路径
@@ -15,6 +17,16 @@ var (
 	ProblemsFile        = "problems.json"
 	TestCasesFile       = "testcases.json"
 	UserProblemStatFile = "user_problem_statuses.json"
+
+	// 以下文件由 db.MemoryStore 通过 WriteJSON/LoadJSON 读写
+	UsersFile            = "users.json"
+	SubmissionsFile      = "submissions.json"
+	TestResultsFile      = "test_results.json"
+	OutlineQuestionsFile = "outline_questions.json"
+	QuizzesFile          = "quizzes.json"
+	QuizSubmissionsFile  = "quiz_submissions.json"
+	QuizResultsFile      = "quiz_results.json"
+	ProblemRevisionsFile = "problem_revisions.json"
 )
 
 // PersistenceManager 管理数据持久化
@@ -46,7 +58,7 @@ func NewPersistenceManager() (*PersistenceManager, error) {
 }
 
 // SaveProblems 保存问题数据到文件
-func (pm *PersistenceManager) SaveProblems(problems map[int]*Problem) error {
+func (pm *PersistenceManager) SaveProblems(problems map[int]*models.Problem) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -58,7 +70,7 @@ func (pm *PersistenceManager) SaveProblems(problems map[int]*Problem) error {
 	filePath := filepath.Join(pm.dataDir, ProblemsFile)
 	log.Printf("正在保存问题数据到: %s (%d个问题)", filePath, len(problems))
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data); err != nil {
 		return fmt.Errorf("保存问题数据失败: %w", err)
 	}
 
@@ -67,7 +79,7 @@ func (pm *PersistenceManager) SaveProblems(problems map[int]*Problem) error {
 }
 
 // LoadProblems 从文件加载问题数据
-func (pm *PersistenceManager) LoadProblems() (map[int]*Problem, error) {
+func (pm *PersistenceManager) LoadProblems() (map[int]*models.Problem, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -78,7 +90,7 @@ func (pm *PersistenceManager) LoadProblems() (map[int]*Problem, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		log.Printf("问题数据文件不存在，返回空map")
 		// 文件不存在，返回空map
-		return make(map[int]*Problem), nil
+		return make(map[int]*models.Problem), nil
 	}
 
 	data, err := os.ReadFile(filePath)
@@ -88,18 +100,25 @@ func (pm *PersistenceManager) LoadProblems() (map[int]*Problem, error) {
 
 	log.Printf("已读取文件数据，大小: %d 字节", len(data))
 
-	var problems map[int]*Problem
+	var problems map[int]*models.Problem
 	if err := json.Unmarshal(data, &problems); err != nil {
 		log.Printf("解析JSON数据失败: %v", err)
 		return nil, fmt.Errorf("解析问题数据失败: %w", err)
 	}
 
+	// 早期版本保存的问题没有 updated_at，视为创建后未修改过
+	for _, problem := range problems {
+		if problem.UpdatedAt.IsZero() {
+			problem.UpdatedAt = problem.CreatedAt
+		}
+	}
+
 	log.Printf("成功加载了 %d 个问题", len(problems))
 	return problems, nil
 }
 
 // SaveTestCases 保存测试用例数据到文件
-func (pm *PersistenceManager) SaveTestCases(testCases map[int][]*TestCase) error {
+func (pm *PersistenceManager) SaveTestCases(testCases map[int][]*models.TestCase) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -111,7 +130,7 @@ func (pm *PersistenceManager) SaveTestCases(testCases map[int][]*TestCase) error
 	filePath := filepath.Join(pm.dataDir, TestCasesFile)
 	log.Printf("正在保存测试用例数据到: %s", filePath)
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data); err != nil {
 		return fmt.Errorf("保存测试用例数据失败: %w", err)
 	}
 
@@ -125,7 +144,7 @@ func (pm *PersistenceManager) SaveTestCases(testCases map[int][]*TestCase) error
 }
 
 // LoadTestCases 从文件加载测试用例数据
-func (pm *PersistenceManager) LoadTestCases() (map[int][]*TestCase, error) {
+func (pm *PersistenceManager) LoadTestCases() (map[int][]*models.TestCase, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -136,7 +155,7 @@ func (pm *PersistenceManager) LoadTestCases() (map[int][]*TestCase, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		log.Printf("测试用例数据文件不存在，返回空map")
 		// 文件不存在，返回空map
-		return make(map[int][]*TestCase), nil
+		return make(map[int][]*models.TestCase), nil
 	}
 
 	data, err := os.ReadFile(filePath)
@@ -146,7 +165,7 @@ func (pm *PersistenceManager) LoadTestCases() (map[int][]*TestCase, error) {
 
 	log.Printf("已读取测试用例文件数据，大小: %d 字节", len(data))
 
-	var testCases map[int][]*TestCase
+	var testCases map[int][]*models.TestCase
 	if err := json.Unmarshal(data, &testCases); err != nil {
 		log.Printf("解析测试用例JSON数据失败: %v", err)
 		return nil, fmt.Errorf("解析测试用例数据失败: %w", err)
@@ -174,7 +193,7 @@ func (pm *PersistenceManager) SaveUserProblemStatuses(statuses map[string]*UserP
 	filePath := filepath.Join(pm.dataDir, UserProblemStatFile)
 	log.Printf("正在保存用户题目状态数据到: %s (%d个状态)", filePath, len(statuses))
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data); err != nil {
 		return fmt.Errorf("保存用户题目状态数据失败: %w", err)
 	}
 
@@ -213,3 +232,69 @@ func (pm *PersistenceManager) LoadUserProblemStatuses() (map[string]*UserProblem
 	log.Printf("成功加载了 %d 个用户题目状态", len(statuses))
 	return statuses, nil
 }
+
+// WriteJSON 将已序列化的JSON保存到数据目录下的 fileName。不同文件可以同时写入，
+// 同一文件的写入须由调用方串行化
+func (pm *PersistenceManager) WriteJSON(fileName string, data []byte) error {
+	if err := writeFileAtomic(filepath.Join(pm.dataDir, fileName), data); err != nil {
+		return fmt.Errorf("保存 %s 失败: %w", fileName, err)
+	}
+	return nil
+}
+
+// LoadJSON 从数据目录下的 fileName 读取JSON到 v，文件不存在时返回 false
+func (pm *PersistenceManager) LoadJSON(fileName string, v interface{}) (bool, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(pm.dataDir, fileName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取 %s 失败: %w", fileName, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("解析 %s 失败: %w", fileName, err)
+	}
+	return true, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件并同步到磁盘，再重命名为目标文件，
+// 使进程崩溃或断电时目标文件要么是旧内容，要么是完整的新内容
+func writeFileAtomic(filePath string, data []byte) error {
+	dir := filepath.Dir(filePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后不再存在
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp 创建的文件权限为0600
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+
+	// 同步目录使重命名落盘；部分系统（如Windows）不支持同步目录，忽略其错误
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -5,57 +5,31 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"github.com/user/cppjudge/internal/models"
 )
 
 // 错误定义
 var ErrNotFound = errors.New("not found")
 
-// 问题难度级别
-type Difficulty string
-
-const (
-	Easy   Difficulty = "Easy"
-	Medium Difficulty = "Medium"
-	Hard   Difficulty = "Hard"
-)
-
-// 问题结构体定义
-type Problem struct {
-	ID                int        `json:"id"`
-	Title             string     `json:"title"`
-	Description       string     `json:"description"`
-	Difficulty        Difficulty `json:"difficulty"`
-	TimeLimit         int        `json:"time_limit"`         // 以毫秒为单位
-	MemoryLimit       int        `json:"memory_limit"`       // 以KB为单位
-	KnowledgeTag      []string   `json:"knowledge_tag"`      // 知识点标签
-	ReferenceSolution string     `json:"reference_solution"` // 参考解答
-	ThinkingAnalysis  string     `json:"thinking_analysis"`  // 思维分析
-	CreatedAt         time.Time  `json:"created_at"`
-}
-
-// 测试用例结构体定义
-type TestCase struct {
-	ID        int    `json:"id"`
-	ProblemID int    `json:"problem_id"`
-	Input     string `json:"input"`
-	Output    string `json:"output"`
-	IsExample bool   `json:"is_example"`
-}
-
 // 问题存储接口
 type ProblemStore interface {
-	GetProblem(id int) (*Problem, error)
-	GetProblems() ([]*Problem, error)
-	CreateProblem(problem *Problem) (*Problem, error)
-	GetTestCases(problemID int) ([]*TestCase, error)
-	GetExamples(problemID int) ([]*TestCase, error)
-	AddTestCase(testCase *TestCase) (*TestCase, error)
+	GetProblem(id int) (*models.Problem, error)
+	GetProblems() ([]*models.Problem, error)
+	CreateProblem(problem *models.Problem) (*models.Problem, error)
+	UpdateProblem(problem *models.Problem) (*models.Problem, error)
+	DeleteProblem(id int) error
+	GetTestCases(problemID int) ([]*models.TestCase, error)
+	GetExamples(problemID int) ([]*models.TestCase, error)
+	AddTestCase(testCase *models.TestCase) (*models.TestCase, error)
+	UpdateTestCase(testCase *models.TestCase) (*models.TestCase, error)
+	DeleteTestCase(problemID, testCaseID int) error
 }
 
 // 内存中的问题存储实现
 type InMemoryProblemStore struct {
-	problems    map[int]*Problem
-	testCases   map[int][]*TestCase
+	problems    map[int]*models.Problem
+	testCases   map[int][]*models.TestCase
 	problemID   int
 	testCaseID  int
 	mu          sync.RWMutex
@@ -72,8 +46,8 @@ func NewInMemoryProblemStore() *InMemoryProblemStore {
 	}
 
 	store := &InMemoryProblemStore{
-		problems:    make(map[int]*Problem),
-		testCases:   make(map[int][]*TestCase),
+		problems:    make(map[int]*models.Problem),
+		testCases:   make(map[int][]*models.TestCase),
 		problemID:   0,
 		testCaseID:  0,
 		persistence: persistenceManager,
@@ -156,7 +130,7 @@ func (s *InMemoryProblemStore) saveData() {
 	}
 }
 
-func (s *InMemoryProblemStore) GetProblem(id int) (*Problem, error) {
+func (s *InMemoryProblemStore) GetProblem(id int) (*models.Problem, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -168,11 +142,11 @@ func (s *InMemoryProblemStore) GetProblem(id int) (*Problem, error) {
 	return problem, nil
 }
 
-func (s *InMemoryProblemStore) GetProblems() ([]*Problem, error) {
+func (s *InMemoryProblemStore) GetProblems() ([]*models.Problem, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	problems := make([]*Problem, 0, len(s.problems))
+	problems := make([]*models.Problem, 0, len(s.problems))
 	for _, problem := range s.problems {
 		problems = append(problems, problem)
 	}
@@ -180,13 +154,14 @@ func (s *InMemoryProblemStore) GetProblems() ([]*Problem, error) {
 	return problems, nil
 }
 
-func (s *InMemoryProblemStore) CreateProblem(problem *Problem) (*Problem, error) {
+func (s *InMemoryProblemStore) CreateProblem(problem *models.Problem) (*models.Problem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.problemID++
 	problem.ID = s.problemID
 	problem.CreatedAt = time.Now()
+	problem.UpdatedAt = problem.CreatedAt
 
 	s.problems[problem.ID] = problem
 
@@ -198,28 +173,28 @@ func (s *InMemoryProblemStore) CreateProblem(problem *Problem) (*Problem, error)
 	return problem, nil
 }
 
-func (s *InMemoryProblemStore) GetTestCases(problemID int) ([]*TestCase, error) {
+func (s *InMemoryProblemStore) GetTestCases(problemID int) ([]*models.TestCase, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	testCases, exists := s.testCases[problemID]
 	if !exists {
-		return []*TestCase{}, nil
+		return []*models.TestCase{}, nil
 	}
 
 	return testCases, nil
 }
 
-func (s *InMemoryProblemStore) GetExamples(problemID int) ([]*TestCase, error) {
+func (s *InMemoryProblemStore) GetExamples(problemID int) ([]*models.TestCase, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	testCases, exists := s.testCases[problemID]
 	if !exists {
-		return []*TestCase{}, nil
+		return []*models.TestCase{}, nil
 	}
 
-	examples := make([]*TestCase, 0)
+	examples := make([]*models.TestCase, 0)
 	for _, tc := range testCases {
 		if tc.IsExample {
 			examples = append(examples, tc)
@@ -229,7 +204,7 @@ func (s *InMemoryProblemStore) GetExamples(problemID int) ([]*TestCase, error) {
 	return examples, nil
 }
 
-func (s *InMemoryProblemStore) AddTestCase(testCase *TestCase) (*TestCase, error) {
+func (s *InMemoryProblemStore) AddTestCase(testCase *models.TestCase) (*models.TestCase, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -243,7 +218,7 @@ func (s *InMemoryProblemStore) AddTestCase(testCase *TestCase) (*TestCase, error
 	testCase.ID = s.testCaseID
 
 	if _, exists := s.testCases[testCase.ProblemID]; !exists {
-		s.testCases[testCase.ProblemID] = make([]*TestCase, 0)
+		s.testCases[testCase.ProblemID] = make([]*models.TestCase, 0)
 	}
 
 	s.testCases[testCase.ProblemID] = append(s.testCases[testCase.ProblemID], testCase)
@@ -256,10 +231,181 @@ func (s *InMemoryProblemStore) AddTestCase(testCase *TestCase) (*TestCase, error
 	return testCase, nil
 }
 
+// UpdateProblem 替换已有问题，保留其创建时间
+func (s *InMemoryProblemStore) UpdateProblem(problem *models.Problem) (*models.Problem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.problems[problem.ID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	problem.CreatedAt = existing.CreatedAt
+	problem.UpdatedAt = time.Now()
+	s.problems[problem.ID] = problem
+
+	log.Printf("更新问题: ID=%d, 标题=%s", problem.ID, problem.Title)
+
+	// 保存数据
+	s.saveData()
+
+	return problem, nil
+}
+
+// DeleteProblem 删除问题及其所有测试用例
+func (s *InMemoryProblemStore) DeleteProblem(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.problems[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.problems, id)
+	delete(s.testCases, id)
+
+	log.Printf("删除问题: ID=%d", id)
+
+	// 保存数据
+	s.saveData()
+
+	return nil
+}
+
+// UpdateTestCase 替换问题中已有的测试用例，测试用例须属于 testCase.ProblemID
+func (s *InMemoryProblemStore) UpdateTestCase(testCase *models.TestCase) (*models.TestCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cases := s.testCases[testCase.ProblemID]
+	for i, tc := range cases {
+		if tc.ID == testCase.ID {
+			// 复制一份，不修改可能仍被读取的原切片
+			updated := append([]*models.TestCase(nil), cases...)
+			updated[i] = testCase
+			s.testCases[testCase.ProblemID] = updated
+
+			log.Printf("更新测试用例: ID=%d, 问题ID=%d, 示例=%v", testCase.ID, testCase.ProblemID, testCase.IsExample)
+
+			// 保存数据
+			s.saveData()
+
+			return testCase, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// DeleteTestCase 删除问题中的一个测试用例
+func (s *InMemoryProblemStore) DeleteTestCase(problemID, testCaseID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cases := s.testCases[problemID]
+	for i, tc := range cases {
+		if tc.ID == testCaseID {
+			// 复制一份，不修改可能仍被读取的原切片
+			remaining := make([]*models.TestCase, 0, len(cases)-1)
+			remaining = append(remaining, cases[:i]...)
+			s.testCases[problemID] = append(remaining, cases[i+1:]...)
+
+			log.Printf("删除测试用例: ID=%d, 问题ID=%d", testCaseID, problemID)
+
+			// 保存数据
+			s.saveData()
+
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// RestoreProblem 在一次操作中替换问题及其全部测试用例，用于回滚题目，保留问题的创建时间。
+// 测试用例保留原ID，ID为0或已被其他问题使用时分配新ID
+func (s *InMemoryProblemStore) RestoreProblem(problem *models.Problem, testCases []*models.TestCase) (*models.Problem, []*models.TestCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problemID := problem.ID
+	existing, exists := s.problems[problemID]
+	if !exists {
+		return nil, nil, ErrNotFound
+	}
+	problem.CreatedAt = existing.CreatedAt
+	problem.UpdatedAt = time.Now()
+
+	used := make(map[int]bool)
+	for id, cases := range s.testCases {
+		if id == problemID {
+			continue
+		}
+		for _, tc := range cases {
+			used[tc.ID] = true
+		}
+	}
+
+	cases := make([]*models.TestCase, 0, len(testCases))
+	for _, tc := range testCases {
+		if tc.ID == 0 || used[tc.ID] {
+			s.testCaseID++
+			tc.ID = s.testCaseID
+		} else if tc.ID > s.testCaseID {
+			s.testCaseID = tc.ID
+		}
+		used[tc.ID] = true
+		tc.ProblemID = problemID
+		cases = append(cases, tc)
+	}
+	s.problems[problemID] = problem
+	s.testCases[problemID] = cases
+
+	log.Printf("恢复问题: ID=%d, 标题=%s, 测试用例 %d 个", problemID, problem.Title, len(cases))
+
+	// 保存数据
+	s.saveData()
+
+	return problem, cases, nil
+}
+
+// ReloadTestCases 从文件重新读取一个问题的测试用例，使手动修改 testcases.json 后
+// 无需重启即可生效。返回读取到的测试用例数量
+func (s *InMemoryProblemStore) ReloadTestCases(problemID int) (int, error) {
+	if s.persistence == nil {
+		return 0, errors.New("persistence is not available")
+	}
+
+	testCases, err := s.persistence.LoadTestCases()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.problems[problemID]; !exists {
+		return 0, ErrNotFound
+	}
+
+	cases := testCases[problemID]
+	for _, tc := range cases {
+		tc.ProblemID = problemID
+		if tc.ID > s.testCaseID {
+			s.testCaseID = tc.ID
+		}
+	}
+	s.testCases[problemID] = cases
+
+	log.Printf("重新加载问题 %d 的 %d 个测试用例", problemID, len(cases))
+	return len(cases), nil
+}
+
 // ProblemImport 表示要导入的问题及其测试用例
 type ProblemImport struct {
-	Problem   *Problem    `json:"problem"`
-	TestCases []*TestCase `json:"test_cases"`
+	Problem   *models.Problem    `json:"problem"`
+	TestCases []*models.TestCase `json:"test_cases"`
 }
 
 // ImportProblems 批量导入多个问题及其测试用例
@@ -277,6 +423,7 @@ func (s *InMemoryProblemStore) ImportProblems(imports []*ProblemImport) ([]int,
 		s.problemID++
 		item.Problem.ID = s.problemID
 		item.Problem.CreatedAt = time.Now()
+		item.Problem.UpdatedAt = item.Problem.CreatedAt
 		s.problems[item.Problem.ID] = item.Problem
 		importedIDs = append(importedIDs, item.Problem.ID)
 
@@ -289,7 +436,7 @@ func (s *InMemoryProblemStore) ImportProblems(imports []*ProblemImport) ([]int,
 			tc.ProblemID = item.Problem.ID
 
 			if _, exists := s.testCases[item.Problem.ID]; !exists {
-				s.testCases[item.Problem.ID] = make([]*TestCase, 0)
+				s.testCases[item.Problem.ID] = make([]*models.TestCase, 0)
 			}
 			s.testCases[item.Problem.ID] = append(s.testCases[item.Problem.ID], tc)
 
@@ -320,10 +467,10 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	defer s.mu.Unlock()
 
 	// 题目1：两数之和
-	problem1 := &Problem{
+	problem1 := &models.Problem{
 		Title:        "两数之和",
 		Description:  "给定一个整数数组 nums 和一个整数目标值 target，请你在该数组中找出和为目标值的那两个整数，并返回它们的数组下标。\n\n你可以假设每种输入只会对应一个答案。但是，数组中同一个元素不能使用两次。\n\n你可以按任意顺序返回答案。",
-		Difficulty:   Easy,
+		Difficulty:   models.DifficultyEasy,
 		TimeLimit:    1000,
 		MemoryLimit:  65536,
 		KnowledgeTag: []string{"数组", "哈希表"},
@@ -331,11 +478,12 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.problemID++
 	problem1.ID = s.problemID
 	problem1.CreatedAt = time.Now()
+	problem1.UpdatedAt = problem1.CreatedAt
 	s.problems[problem1.ID] = problem1
 	log.Printf("添加示例问题1: ID=%d, 标题=%s", problem1.ID, problem1.Title)
 
 	// 题目1的测试用例
-	testCases1 := []*TestCase{
+	testCases1 := []*models.TestCase{
 		{
 			Input:     "nums = [2,7,11,15], target = 9",
 			Output:    "[0,1]",
@@ -361,10 +509,10 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.testCases[problem1.ID] = testCases1
 
 	// 题目2：回文数
-	problem2 := &Problem{
+	problem2 := &models.Problem{
 		Title:        "回文数",
 		Description:  "给你一个整数 x ，如果 x 是一个回文整数，返回 true ；否则，返回 false 。\n\n回文数是指正序（从左向右）和倒序（从右向左）读都是一样的整数。\n\n例如，121 是回文，而 123 不是。",
-		Difficulty:   Easy,
+		Difficulty:   models.DifficultyEasy,
 		TimeLimit:    1000,
 		MemoryLimit:  65536,
 		KnowledgeTag: []string{"数学", "字符串"},
@@ -372,11 +520,12 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.problemID++
 	problem2.ID = s.problemID
 	problem2.CreatedAt = time.Now()
+	problem2.UpdatedAt = problem2.CreatedAt
 	s.problems[problem2.ID] = problem2
 	log.Printf("添加示例问题2: ID=%d, 标题=%s", problem2.ID, problem2.Title)
 
 	// 题目2的测试用例
-	testCases2 := []*TestCase{
+	testCases2 := []*models.TestCase{
 		{
 			Input:     "x = 121",
 			Output:    "true",
@@ -402,10 +551,10 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.testCases[problem2.ID] = testCases2
 
 	// 题目3：合并两个有序链表
-	problem3 := &Problem{
+	problem3 := &models.Problem{
 		Title:        "合并两个有序链表",
 		Description:  "将两个升序链表合并为一个新的升序链表并返回。新链表是通过拼接给定的两个链表的所有节点组成的。",
-		Difficulty:   Easy,
+		Difficulty:   models.DifficultyEasy,
 		TimeLimit:    1000,
 		MemoryLimit:  65536,
 		KnowledgeTag: []string{"链表", "递归"},
@@ -413,11 +562,12 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.problemID++
 	problem3.ID = s.problemID
 	problem3.CreatedAt = time.Now()
+	problem3.UpdatedAt = problem3.CreatedAt
 	s.problems[problem3.ID] = problem3
 	log.Printf("添加示例问题3: ID=%d, 标题=%s", problem3.ID, problem3.Title)
 
 	// 题目3的测试用例
-	testCase3 := &TestCase{
+	testCase3 := &models.TestCase{
 		Input:     "l1 = [1,2,4], l2 = [1,3,4]",
 		Output:    "[1,1,2,3,4,4]",
 		IsExample: true,
@@ -425,7 +575,7 @@ func (s *InMemoryProblemStore) addSampleProblems() {
 	s.testCaseID++
 	testCase3.ID = s.testCaseID
 	testCase3.ProblemID = problem3.ID
-	s.testCases[problem3.ID] = []*TestCase{testCase3}
+	s.testCases[problem3.ID] = []*models.TestCase{testCase3}
 
 	log.Println("示例问题添加完成，准备保存到文件")
 
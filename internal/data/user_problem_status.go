@@ -15,6 +15,7 @@ type UserProblemStatus struct {
 	Attempted      bool      `json:"attempted"`       // 用户是否尝试过该题目
 	Solved         bool      `json:"solved"`          // 用户是否解决了该题目
 	FailedAttempts int       `json:"failed_attempts"` // 失败尝试次数
+	BestScore      int       `json:"best_score"`      // 最高得分
 	LastAttemptAt  time.Time `json:"last_attempt_at"` // 最后一次尝试的时间
 	FirstSolvedAt  time.Time `json:"first_solved_at"` // 首次解决的时间
 	CreatedAt      time.Time `json:"created_at"`
@@ -27,6 +28,7 @@ type UserProblemStatusStore interface {
 	GetUserProblemStatuses(userID int) ([]*UserProblemStatus, error)
 	GetProblemUserStatuses(problemID int) ([]*UserProblemStatus, error)
 	UpdateUserProblemStatus(status *UserProblemStatus) (*UserProblemStatus, error)
+	DeleteProblemUserStatuses(problemID int) (int, error)
 }
 
 // InMemoryUserProblemStatusStore 实现了用户题目状态的内存存储
@@ -181,3 +183,26 @@ func (s *InMemoryUserProblemStatusStore) UpdateUserProblemStatus(status *UserPro
 
 	return status, nil
 }
+
+// DeleteProblemUserStatuses 删除特定题目的所有用户状态，返回删除的数量
+func (s *InMemoryUserProblemStatusStore) DeleteProblemUserStatuses(problemID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, status := range s.statuses {
+		if status.ProblemID == problemID {
+			delete(s.statuses, key)
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("删除题目 %d 的 %d 个用户题目状态", problemID, deleted)
+
+		// 保存数据
+		s.saveData()
+	}
+
+	return deleted, nil
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"sort"
 	"strings"
 	"sync"
@@ -20,6 +22,8 @@ type MemoryStore struct {
 	testResults              map[int]models.TestResult
 	problemStore             *data.InMemoryProblemStore           // 使用带持久化功能的问题存储
 	userProblemStore         *data.InMemoryUserProblemStatusStore // 用户题目状态存储
+	persistence              *data.PersistenceManager             // 保存其余数据，为nil时只保存在内存中
+	files                    map[string]*dataFile                 // persistence 保存的各数据文件
 	nextUserID               int
 	nextSubmitID             int
 	nextResultID             int
@@ -30,6 +34,7 @@ type MemoryStore struct {
 	quizzes                  map[int]*models.Quiz
 	quizSubmissions          map[int]*models.QuizSubmission
 	quizResults              map[int]*models.QuizResult
+	problemRevisions         map[int]models.ProblemRevision
 	userIDCounter            int
 	problemIDCounter         int
 	testCaseIDCounter        int
@@ -40,11 +45,13 @@ type MemoryStore struct {
 	quizCounter              int
 	quizSubmissionCounter    int
 	quizResultCounter        int
+	problemRevisionCounter   int
 }
 
-// NewMemoryStore creates a new in-memory database
+// NewMemoryStore creates a new in-memory database. Its data is saved to JSON
+// files in the data directory as it changes and loaded from them here.
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
+	store := &MemoryStore{
 		users:                    make(map[int]models.User),
 		submissions:              make(map[int]models.Submission),
 		testResults:              make(map[int]models.TestResult),
@@ -60,6 +67,7 @@ func NewMemoryStore() *MemoryStore {
 		quizzes:                  make(map[int]*models.Quiz),
 		quizSubmissions:          make(map[int]*models.QuizSubmission),
 		quizResults:              make(map[int]*models.QuizResult),
+		problemRevisions:         make(map[int]models.ProblemRevision),
 		userIDCounter:            1,
 		problemIDCounter:         1,
 		testCaseIDCounter:        1,
@@ -70,29 +78,229 @@ func NewMemoryStore() *MemoryStore {
 		quizCounter:              1,
 		quizSubmissionCounter:    1,
 		quizResultCounter:        1,
+		problemRevisionCounter:   1,
 	}
+
+	persistence, err := data.NewPersistenceManager()
+	if err != nil {
+		log.Printf("警告: 创建持久化管理器失败: %v, 用户与提交将只保存在内存中", err)
+		return store
+	}
+	store.persistence = persistence
+	store.files = store.dataFiles()
+	store.loadData()
+
+	return store
 }
 
-// AddUser adds a new user to the store
-func (s *MemoryStore) AddUser(user models.User) (models.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// persistedUser 保存用户时包含密码的bcrypt哈希，models.User 的JSON格式不含密码
+type persistedUser struct {
+	models.User
+	Password string `json:"password"`
+}
 
-	// Check if username already exists
-	for _, existingUser := range s.users {
-		if existingUser.Username == user.Username {
-			return models.User{}, errors.New("username already exists")
+// loadData 从文件加载用户、提交、测试结果、测验数据与题目修订，并将各ID计数器恢复为最大ID加一
+func (s *MemoryStore) loadData() {
+	var users map[int]persistedUser
+	if s.load(data.UsersFile, &users) {
+		hashed := 0
+		for id, user := range users {
+			// 早先保存的明文密码改为保存其哈希
+			if hash, err := hashPassword(user.Password); err != nil {
+				log.Printf("用户 %d 的密码哈希失败: %v", id, err)
+			} else if hash != user.Password {
+				user.Password = hash
+				hashed++
+			}
+			user.User.Password = user.Password
+			s.users[id] = user.User
+			s.nextUserID = max(s.nextUserID, id+1)
+		}
+		if hashed > 0 {
+			s.update(func(save func(string)) error {
+				save(data.UsersFile)
+				return nil
+			})
+		}
+	}
+	if s.load(data.SubmissionsFile, &s.submissions) {
+		for id := range s.submissions {
+			s.nextSubmitID = max(s.nextSubmitID, id+1)
+		}
+	}
+	if s.load(data.TestResultsFile, &s.testResults) {
+		for id := range s.testResults {
+			s.nextResultID = max(s.nextResultID, id+1)
+		}
+	}
+	if s.load(data.OutlineQuestionsFile, &s.outlineQuestions) {
+		for id := range s.outlineQuestions {
+			s.outlineQuestionCounter = max(s.outlineQuestionCounter, id+1)
 		}
-		if existingUser.Email == user.Email {
-			return models.User{}, errors.New("email already exists")
+	}
+	if s.load(data.QuizzesFile, &s.quizzes) {
+		for id := range s.quizzes {
+			s.quizCounter = max(s.quizCounter, id+1)
+		}
+	}
+	if s.load(data.QuizSubmissionsFile, &s.quizSubmissions) {
+		for id := range s.quizSubmissions {
+			s.quizSubmissionCounter = max(s.quizSubmissionCounter, id+1)
+		}
+	}
+	if s.load(data.QuizResultsFile, &s.quizResults) {
+		for id := range s.quizResults {
+			s.quizResultCounter = max(s.quizResultCounter, id+1)
 		}
 	}
 
-	user.ID = s.nextUserID
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
-	s.nextUserID++
-	s.users[user.ID] = user
+	if s.load(data.ProblemRevisionsFile, &s.problemRevisions) {
+		for id := range s.problemRevisions {
+			s.problemRevisionCounter = max(s.problemRevisionCounter, id+1)
+		}
+	}
+
+	log.Printf("从存储中加载 %d 个用户、%d 个提交、%d 个测试结果、%d 个大纲题目、%d 个测验、%d 个测验提交、%d 个测验结果与 %d 个题目修订",
+		len(s.users), len(s.submissions), len(s.testResults), len(s.outlineQuestions),
+		len(s.quizzes), len(s.quizSubmissions), len(s.quizResults), len(s.problemRevisions))
+}
+
+// load 读取一个数据文件到 v，文件不存在或读取失败时返回 false
+func (s *MemoryStore) load(fileName string, v interface{}) bool {
+	found, err := s.persistence.LoadJSON(fileName, v)
+	if err != nil {
+		log.Printf("加载数据失败: %v", err)
+		return false
+	}
+	return found
+}
+
+// dataFile 是 persistence 保存的一个数据文件
+type dataFile struct {
+	name    string
+	value   func() interface{} // 返回要保存的数据，调用时持有 s.mu 读锁
+	changed uint64             // 最近一次修改的序号，由 s.mu 保护
+
+	mu      sync.Mutex // 串行化对该文件的写入，保护以下字段
+	written uint64     // 最近一次写入所包含的修改序号
+	err     error      // 最近一次写入的结果
+}
+
+// dataFiles 返回各数据文件与其保存的数据
+func (s *MemoryStore) dataFiles() map[string]*dataFile {
+	files := map[string]*dataFile{
+		data.UsersFile: {value: func() interface{} {
+			// 保存用户时包含密码
+			users := make(map[int]persistedUser, len(s.users))
+			for id, user := range s.users {
+				users[id] = persistedUser{User: user, Password: user.Password}
+			}
+			return users
+		}},
+		data.SubmissionsFile:      {value: func() interface{} { return s.submissions }},
+		data.TestResultsFile:      {value: func() interface{} { return s.testResults }},
+		data.OutlineQuestionsFile: {value: func() interface{} { return s.outlineQuestions }},
+		data.QuizzesFile:          {value: func() interface{} { return s.quizzes }},
+		data.QuizSubmissionsFile:  {value: func() interface{} { return s.quizSubmissions }},
+		data.QuizResultsFile:      {value: func() interface{} { return s.quizResults }},
+		data.ProblemRevisionsFile: {value: func() interface{} { return s.problemRevisions }},
+	}
+	for name, file := range files {
+		file.name = name
+	}
+	return files
+}
+
+// update 在持有 s.mu 时运行 change，change 通过 save 标记它修改过的数据文件。
+// 这些文件在释放 s.mu 之后保存：序列化只持有读锁，写入磁盘时不持有 s.mu，
+// 同一文件的并发保存合并为一次写入。change 失败时返回其错误，否则返回保存的错误；
+// 保存失败的修改仍保留在内存中，随该文件的下一次保存写入
+func (s *MemoryStore) update(change func(save func(fileName string)) error) error {
+	var saves []*dataFile
+	var changes []uint64
+
+	s.mu.Lock()
+	err := change(func(fileName string) {
+		if s.persistence == nil {
+			return
+		}
+		file := s.files[fileName]
+		file.changed++
+		saves = append(saves, file)
+		changes = append(changes, file.changed)
+	})
+	s.mu.Unlock()
+
+	for i, file := range saves {
+		if saveErr := s.save(file, changes[i]); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// save 将数据文件写入磁盘，直到写入的内容包含序号为 change 的修改
+func (s *MemoryStore) save(file *dataFile, change uint64) error {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	// 等待期间，另一次写入已包含了这次修改
+	if file.written >= change {
+		return file.err
+	}
+
+	s.mu.RLock()
+	latest := file.changed
+	content, err := json.MarshalIndent(file.value(), "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		err = fmt.Errorf("序列化 %s 失败: %w", file.name, err)
+	} else {
+		err = s.persistence.WriteJSON(file.name, content)
+	}
+
+	file.written, file.err = latest, err
+	if err != nil {
+		log.Printf("保存数据失败: %v", err)
+	}
+	return err
+}
+
+// Close does nothing; the problem data is saved as it changes
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// AddUser adds a new user to the store
+func (s *MemoryStore) AddUser(user models.User) (models.User, error) {
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.Password = hash
+
+	err = s.update(func(save func(string)) error {
+		// Check if username already exists
+		for _, existingUser := range s.users {
+			if existingUser.Username == user.Username {
+				return errors.New("username already exists")
+			}
+			if existingUser.Email == user.Email {
+				return errors.New("email already exists")
+			}
+		}
+
+		user.ID = s.nextUserID
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		s.nextUserID++
+		s.users[user.ID] = user
+		save(data.UsersFile)
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
 
 	return user, nil
 }
@@ -126,90 +334,102 @@ func (s *MemoryStore) GetUserByUsername(username string) (models.User, error) {
 
 // AddProblem adds a new problem
 func (s *MemoryStore) AddProblem(problem models.Problem) (models.Problem, error) {
-	// 转换为data.Problem
-	dataProblem := &data.Problem{
-		ID:                problem.ID,
-		Title:             problem.Title,
-		Description:       problem.Description,
-		Difficulty:        data.Difficulty(problem.Difficulty),
-		TimeLimit:         problem.TimeLimit,
-		MemoryLimit:       problem.MemoryLimit,
-		KnowledgeTag:      problem.KnowledgeTag,
-		ReferenceSolution: problem.ReferenceSolution,
-		ThinkingAnalysis:  problem.ThinkingAnalysis,
-		CreatedAt:         problem.CreatedAt,
-	}
-
-	// 使用problemStore创建问题
-	result, err := s.problemStore.CreateProblem(dataProblem)
+	// 使用problemStore创建问题，其保存的是副本
+	result, err := s.problemStore.CreateProblem(&problem)
 	if err != nil {
 		return models.Problem{}, err
 	}
 
-	// 转换回models.Problem
-	return models.Problem{
-		ID:                result.ID,
-		Title:             result.Title,
-		Description:       result.Description,
-		Difficulty:        string(result.Difficulty),
-		TimeLimit:         result.TimeLimit,
-		MemoryLimit:       result.MemoryLimit,
-		KnowledgeTag:      result.KnowledgeTag,
-		ReferenceSolution: result.ReferenceSolution,
-		ThinkingAnalysis:  result.ThinkingAnalysis,
-		CreatedAt:         result.CreatedAt,
-		UpdatedAt:         time.Now(),
-	}, nil
+	return *result, nil
 }
 
 // GetProblemByID retrieves a problem by ID
 func (s *MemoryStore) GetProblemByID(id int) (models.Problem, error) {
-	// 使用problemStore获取问题
-	dataProblem, err := s.problemStore.GetProblem(id)
+	problem, err := s.problemStore.GetProblem(id)
 	if err != nil {
 		return models.Problem{}, err
 	}
 
-	// 转换为models.Problem
-	return models.Problem{
-		ID:                dataProblem.ID,
-		Title:             dataProblem.Title,
-		Description:       dataProblem.Description,
-		Difficulty:        string(dataProblem.Difficulty),
-		TimeLimit:         dataProblem.TimeLimit,
-		MemoryLimit:       dataProblem.MemoryLimit,
-		KnowledgeTag:      dataProblem.KnowledgeTag,
-		ReferenceSolution: dataProblem.ReferenceSolution,
-		ThinkingAnalysis:  dataProblem.ThinkingAnalysis,
-		CreatedAt:         dataProblem.CreatedAt,
-		UpdatedAt:         time.Now(),
-	}, nil
+	return *problem, nil
+}
+
+// UpdateProblem replaces a problem, keeping its creation time
+func (s *MemoryStore) UpdateProblem(problem models.Problem) (models.Problem, error) {
+	result, err := s.problemStore.UpdateProblem(&problem)
+	if err != nil {
+		return models.Problem{}, err
+	}
+
+	return *result, nil
+}
+
+// DeleteProblem removes a problem together with its test cases, its
+// submissions and their test results, its revisions, and the users' statuses
+// on it. s.mu is held throughout, so that no submission is added or queued
+// for rejudging between the check for submissions being judged and the
+// deletion.
+func (s *MemoryStore) DeleteProblem(id int) error {
+	return s.update(func(save func(string)) error {
+		if _, err := s.problemStore.GetProblem(id); err != nil {
+			return err
+		}
+		for _, submission := range s.submissions {
+			if submission.ProblemID == id && isJudging(submission.Status) {
+				return ErrProblemJudging
+			}
+		}
+
+		if err := s.problemStore.DeleteProblem(id); err != nil {
+			return err
+		}
+		if _, err := s.userProblemStore.DeleteProblemUserStatuses(id); err != nil {
+			return err
+		}
+
+		revisions := 0
+		for revisionID, revision := range s.problemRevisions {
+			if revision.ProblemID == id {
+				delete(s.problemRevisions, revisionID)
+				revisions++
+			}
+		}
+		if revisions > 0 {
+			save(data.ProblemRevisionsFile)
+		}
+
+		deleted := make(map[int]bool)
+		for submissionID, submission := range s.submissions {
+			if submission.ProblemID == id {
+				delete(s.submissions, submissionID)
+				deleted[submissionID] = true
+			}
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+		for resultID, result := range s.testResults {
+			if deleted[result.SubmissionID] {
+				delete(s.testResults, resultID)
+			}
+		}
+		save(data.SubmissionsFile)
+		save(data.TestResultsFile)
+
+		return nil
+	})
 }
 
 // ListProblems returns all problems
 func (s *MemoryStore) ListProblems() []models.Problem {
 	// 使用problemStore获取所有问题
-	dataProblems, err := s.problemStore.GetProblems()
+	storedProblems, err := s.problemStore.GetProblems()
 	if err != nil {
 		return []models.Problem{}
 	}
 
-	// 转换为models.Problem切片
-	problems := make([]models.Problem, 0, len(dataProblems))
-	for _, p := range dataProblems {
-		problems = append(problems, models.Problem{
-			ID:                p.ID,
-			Title:             p.Title,
-			Description:       p.Description,
-			Difficulty:        string(p.Difficulty),
-			TimeLimit:         p.TimeLimit,
-			MemoryLimit:       p.MemoryLimit,
-			KnowledgeTag:      p.KnowledgeTag,
-			ReferenceSolution: p.ReferenceSolution,
-			ThinkingAnalysis:  p.ThinkingAnalysis,
-			CreatedAt:         p.CreatedAt,
-			UpdatedAt:         time.Now(),
-		})
+	problems := make([]models.Problem, 0, len(storedProblems))
+	for _, p := range storedProblems {
+		problems = append(problems, *p)
 	}
 
 	// 按照ID倒序排列
@@ -222,85 +442,70 @@ func (s *MemoryStore) ListProblems() []models.Problem {
 
 // AddTestCase adds a new test case
 func (s *MemoryStore) AddTestCase(testCase models.TestCase) (models.TestCase, error) {
-	// 转换为data.TestCase
-	dataTestCase := &data.TestCase{
-		ID:        testCase.ID,
-		ProblemID: testCase.ProblemID,
-		Input:     testCase.Input,
-		Output:    testCase.Output,
-		IsExample: testCase.IsExample,
-	}
-
-	// 使用problemStore添加测试用例
-	result, err := s.problemStore.AddTestCase(dataTestCase)
+	result, err := s.problemStore.AddTestCase(&testCase)
 	if err != nil {
 		return models.TestCase{}, err
 	}
 
-	// 转换回models.TestCase
-	return models.TestCase{
-		ID:        result.ID,
-		ProblemID: result.ProblemID,
-		Input:     result.Input,
-		Output:    result.Output,
-		IsExample: result.IsExample,
-	}, nil
+	return *result, nil
 }
 
 // GetTestCasesByProblemID retrieves all test cases for a problem
 func (s *MemoryStore) GetTestCasesByProblemID(problemID int) ([]models.TestCase, error) {
-	// 使用problemStore获取测试用例
-	dataTestCases, err := s.problemStore.GetTestCases(problemID)
+	storedTestCases, err := s.problemStore.GetTestCases(problemID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 转换为models.TestCase切片
-	testCases := make([]models.TestCase, 0, len(dataTestCases))
-	for _, tc := range dataTestCases {
-		testCases = append(testCases, models.TestCase{
-			ID:        tc.ID,
-			ProblemID: tc.ProblemID,
-			Input:     tc.Input,
-			Output:    tc.Output,
-			IsExample: tc.IsExample,
-		})
+	testCases := make([]models.TestCase, 0, len(storedTestCases))
+	for _, tc := range storedTestCases {
+		testCases = append(testCases, *tc)
 	}
 
 	return testCases, nil
 }
 
+// UpdateTestCase replaces a test case of the problem given by its ProblemID
+func (s *MemoryStore) UpdateTestCase(testCase models.TestCase) (models.TestCase, error) {
+	result, err := s.problemStore.UpdateTestCase(&testCase)
+	if err == data.ErrNotFound {
+		return models.TestCase{}, ErrTestCaseNotFound
+	}
+	if err != nil {
+		return models.TestCase{}, err
+	}
+
+	return *result, nil
+}
+
+// DeleteTestCase removes a test case from a problem. Results of finished
+// submissions on it are kept until they are rejudged.
+func (s *MemoryStore) DeleteTestCase(problemID, testCaseID int) error {
+	err := s.problemStore.DeleteTestCase(problemID, testCaseID)
+	if err == data.ErrNotFound {
+		return ErrTestCaseNotFound
+	}
+	return err
+}
+
 // 批量导入问题和测试用例
 func (s *MemoryStore) ImportProblems(problems []models.Problem, testCases map[int][]models.TestCase) ([]int, error) {
-	// 转换为data.ProblemImport切片
 	imports := make([]*data.ProblemImport, 0, len(problems))
 
-	for i, p := range problems {
-		// 创建data.Problem
-		dataProblem := &data.Problem{
-			Title:        p.Title,
-			Description:  p.Description,
-			Difficulty:   data.Difficulty(p.Difficulty),
-			TimeLimit:    p.TimeLimit,
-			MemoryLimit:  p.MemoryLimit,
-			KnowledgeTag: p.KnowledgeTag,
-		}
+	for i := range problems {
+		problem := problems[i]
 
 		// 获取对应的测试用例
 		cases := testCases[i] // 使用索引作为临时ID
-		dataTestCases := make([]*data.TestCase, 0, len(cases))
-
-		for _, tc := range cases {
-			dataTestCases = append(dataTestCases, &data.TestCase{
-				Input:     tc.Input,
-				Output:    tc.Output,
-				IsExample: tc.IsExample,
-			})
+		importTestCases := make([]*models.TestCase, 0, len(cases))
+		for j := range cases {
+			tc := cases[j]
+			importTestCases = append(importTestCases, &tc)
 		}
 
 		imports = append(imports, &data.ProblemImport{
-			Problem:   dataProblem,
-			TestCases: dataTestCases,
+			Problem:   &problem,
+			TestCases: importTestCases,
 		})
 	}
 
@@ -308,27 +513,134 @@ func (s *MemoryStore) ImportProblems(problems []models.Problem, testCases map[in
 	return s.problemStore.ImportProblems(imports)
 }
 
-// AddSubmission adds a new submission
-func (s *MemoryStore) AddSubmission(submission models.Submission) (models.Submission, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ReloadTestCases re-reads the test cases of a problem from the data file
+func (s *MemoryStore) ReloadTestCases(problemID int) (int, error) {
+	return s.problemStore.ReloadTestCases(problemID)
+}
 
-	// Check if user and problem exist
-	if _, exists := s.users[submission.UserID]; !exists {
-		return models.Submission{}, errors.New("user not found")
+// RestoreProblem replaces a problem and all its test cases at once, keeping
+// the problem's creation time and the test cases' IDs unless another problem
+// uses them
+func (s *MemoryStore) RestoreProblem(problem models.Problem, testCases []models.TestCase) (models.Problem, []models.TestCase, error) {
+	cases := make([]*models.TestCase, 0, len(testCases))
+	for i := range testCases {
+		tc := testCases[i]
+		cases = append(cases, &tc)
 	}
 
-	// 检查problem是否存在
-	_, err := s.problemStore.GetProblem(submission.ProblemID)
+	restored, stored, err := s.problemStore.RestoreProblem(&problem, cases)
 	if err != nil {
-		return models.Submission{}, errors.New("problem not found")
+		return models.Problem{}, nil, err
+	}
+
+	result := make([]models.TestCase, 0, len(stored))
+	for _, tc := range stored {
+		result = append(result, *tc)
+	}
+	return *restored, result, nil
+}
+
+// AddProblemRevision records a revision of a problem, numbered after its
+// latest one
+func (s *MemoryStore) AddProblemRevision(revision models.ProblemRevision) (models.ProblemRevision, error) {
+	if _, err := s.problemStore.GetProblem(revision.ProblemID); err != nil {
+		return models.ProblemRevision{}, errors.New("problem not found")
 	}
 
-	submission.ID = s.nextSubmitID
-	submission.CreatedAt = time.Now()
-	submission.SubmittedAt = time.Now()
-	s.nextSubmitID++
-	s.submissions[submission.ID] = submission
+	err := s.update(func(save func(string)) error {
+		revision.Revision = 1
+		for _, r := range s.problemRevisions {
+			if r.ProblemID == revision.ProblemID && r.Revision >= revision.Revision {
+				revision.Revision = r.Revision + 1
+			}
+		}
+		revision.ID = s.problemRevisionCounter
+		revision.CreatedAt = time.Now()
+		s.problemRevisionCounter++
+		s.problemRevisions[revision.ID] = revision
+		save(data.ProblemRevisionsFile)
+		return nil
+	})
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+
+	return revision, nil
+}
+
+// GetProblemRevisions returns the revisions of a problem, oldest first
+func (s *MemoryStore) GetProblemRevisions(problemID int) ([]models.ProblemRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var revisions []models.ProblemRevision
+	for _, revision := range s.problemRevisions {
+		if revision.ProblemID == problemID {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+// GetProblemRevision retrieves a revision of a problem by its number
+func (s *MemoryStore) GetProblemRevision(problemID, revision int) (models.ProblemRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.problemRevisions {
+		if r.ProblemID == problemID && r.Revision == revision {
+			return r, nil
+		}
+	}
+
+	return models.ProblemRevision{}, errors.New("revision not found")
+}
+
+// GetLatestProblemRevision returns the number of a problem's latest revision,
+// or 0 if it has none
+func (s *MemoryStore) GetLatestProblemRevision(problemID int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := 0
+	for _, r := range s.problemRevisions {
+		if r.ProblemID == problemID && r.Revision > latest {
+			latest = r.Revision
+		}
+	}
+
+	return latest, nil
+}
+
+// AddSubmission adds a new submission
+func (s *MemoryStore) AddSubmission(submission models.Submission) (models.Submission, error) {
+	err := s.update(func(save func(string)) error {
+		// Check if user and problem exist
+		if _, exists := s.users[submission.UserID]; !exists {
+			return errors.New("user not found")
+		}
+
+		// 检查problem是否存在
+		_, err := s.problemStore.GetProblem(submission.ProblemID)
+		if err != nil {
+			return errors.New("problem not found")
+		}
+
+		submission.ID = s.nextSubmitID
+		submission.CreatedAt = time.Now()
+		submission.SubmittedAt = time.Now()
+		s.nextSubmitID++
+		s.submissions[submission.ID] = submission
+		save(data.SubmissionsFile)
+		return nil
+	})
+	if err != nil {
+		return models.Submission{}, err
+	}
 
 	return submission, nil
 }
@@ -340,7 +652,7 @@ func (s *MemoryStore) GetSubmissionByID(id int) (models.Submission, error) {
 
 	submission, exists := s.submissions[id]
 	if !exists {
-		return models.Submission{}, errors.New("submission not found")
+		return models.Submission{}, ErrSubmissionNotFound
 	}
 
 	return submission, nil
@@ -348,50 +660,95 @@ func (s *MemoryStore) GetSubmissionByID(id int) (models.Submission, error) {
 
 // UpdateSubmission updates a submission
 func (s *MemoryStore) UpdateSubmission(submission models.Submission) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.update(func(save func(string)) error {
+		if _, exists := s.submissions[submission.ID]; !exists {
+			return ErrSubmissionNotFound
+		}
+
+		// 评测结束时先保存其测试结果；此前重启时，评测中的提交会被清除结果后重新评测
+		if !isJudging(submission.Status) {
+			save(data.TestResultsFile)
+		}
+		s.submissions[submission.ID] = submission
+		save(data.SubmissionsFile)
+		return nil
+	})
+}
 
-	if _, exists := s.submissions[submission.ID]; !exists {
-		return errors.New("submission not found")
+// GetSubmissionsByProblemID retrieves all submissions of a problem, oldest first
+func (s *MemoryStore) GetSubmissionsByProblemID(problemID int) []models.Submission {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	submissions := make([]models.Submission, 0)
+	for _, submission := range s.submissions {
+		if submission.ProblemID == problemID {
+			submissions = append(submissions, submission)
+		}
 	}
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].ID < submissions[j].ID
+	})
 
-	s.submissions[submission.ID] = submission
-	return nil
+	return submissions
 }
 
-// AddTestResult adds a new test result
-func (s *MemoryStore) AddTestResult(result models.TestResult) (models.TestResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// GetJudgingSubmissions returns the submissions waiting or being judged, oldest first
+func (s *MemoryStore) GetJudgingSubmissions() ([]models.Submission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	// Check if submission exists
-	if _, exists := s.submissions[result.SubmissionID]; !exists {
-		return models.TestResult{}, errors.New("submission not found")
+	submissions := make([]models.Submission, 0)
+	for _, submission := range s.submissions {
+		if isJudging(submission.Status) {
+			submissions = append(submissions, submission)
+		}
 	}
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].ID < submissions[j].ID
+	})
 
-	// 获取测试用例以验证其存在
-	problemID := s.submissions[result.SubmissionID].ProblemID
-	dataTestCases, err := s.problemStore.GetTestCases(problemID)
-	if err != nil {
-		return models.TestResult{}, errors.New("problem not found")
-	}
+	return submissions, nil
+}
 
-	// 验证测试用例ID是否有效
-	found := false
-	for _, tc := range dataTestCases {
-		if tc.ID == result.TestCaseID {
-			found = true
-			break
+// AddTestResult adds a new test result. It is saved once the submission is
+// updated with its final status.
+func (s *MemoryStore) AddTestResult(result models.TestResult) (models.TestResult, error) {
+	err := s.update(func(save func(string)) error {
+		// Check if submission exists
+		if _, exists := s.submissions[result.SubmissionID]; !exists {
+			return ErrSubmissionNotFound
 		}
-	}
 
-	if !found {
-		return models.TestResult{}, errors.New("test case not found")
-	}
+		// 获取测试用例以验证其存在
+		problemID := s.submissions[result.SubmissionID].ProblemID
+		dataTestCases, err := s.problemStore.GetTestCases(problemID)
+		if err != nil {
+			return errors.New("problem not found")
+		}
 
-	result.ID = s.nextResultID
-	s.nextResultID++
-	s.testResults[result.ID] = result
+		// 验证测试用例ID是否有效
+		found := false
+		for _, tc := range dataTestCases {
+			if tc.ID == result.TestCaseID {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return ErrTestCaseNotFound
+		}
+
+		// 测试结果在提交评测结束时随提交一起保存，避免每个测试用例都重写整个文件
+		result.ID = s.nextResultID
+		s.nextResultID++
+		s.testResults[result.ID] = result
+		return nil
+	})
+	if err != nil {
+		return models.TestResult{}, err
+	}
 
 	return result, nil
 }
@@ -403,7 +760,7 @@ func (s *MemoryStore) GetTestResultsBySubmissionID(submissionID int) ([]models.T
 
 	// Check if submission exists
 	if _, exists := s.submissions[submissionID]; !exists {
-		return nil, errors.New("submission not found")
+		return nil, ErrSubmissionNotFound
 	}
 
 	results := make([]models.TestResult, 0)
@@ -416,10 +773,31 @@ func (s *MemoryStore) GetTestResultsBySubmissionID(submissionID int) ([]models.T
 	return results, nil
 }
 
+// DeleteTestResultsBySubmissionID removes all test results of a submission
+func (s *MemoryStore) DeleteTestResultsBySubmissionID(submissionID int) error {
+	return s.update(func(save func(string)) error {
+		if _, exists := s.submissions[submissionID]; !exists {
+			return ErrSubmissionNotFound
+		}
+
+		for id, result := range s.testResults {
+			if result.SubmissionID == submissionID {
+				delete(s.testResults, id)
+			}
+		}
+		save(data.TestResultsFile)
+
+		return nil
+	})
+}
+
 // GetUserProblemStatus 获取用户对特定问题的状态
 func (s *MemoryStore) GetUserProblemStatus(userID, problemID int) (models.UserProblemStatus, error) {
 	// 检查用户是否存在
-	if _, exists := s.users[userID]; !exists {
+	s.mu.RLock()
+	_, exists := s.users[userID]
+	s.mu.RUnlock()
+	if !exists {
 		return models.UserProblemStatus{}, errors.New("user not found")
 	}
 
@@ -453,6 +831,7 @@ func (s *MemoryStore) GetUserProblemStatus(userID, problemID int) (models.UserPr
 		Attempted:      dataStatus.Attempted,
 		Solved:         dataStatus.Solved,
 		FailedAttempts: dataStatus.FailedAttempts,
+		BestScore:      dataStatus.BestScore,
 		LastAttemptAt:  dataStatus.LastAttemptAt,
 		FirstSolvedAt:  dataStatus.FirstSolvedAt,
 		CreatedAt:      dataStatus.CreatedAt,
@@ -463,7 +842,10 @@ func (s *MemoryStore) GetUserProblemStatus(userID, problemID int) (models.UserPr
 // GetUserProblemStatuses 获取用户所有题目的状态
 func (s *MemoryStore) GetUserProblemStatuses(userID int) ([]models.UserProblemStatus, error) {
 	// 检查用户是否存在
-	if _, exists := s.users[userID]; !exists {
+	s.mu.RLock()
+	_, exists := s.users[userID]
+	s.mu.RUnlock()
+	if !exists {
 		return nil, errors.New("user not found")
 	}
 
@@ -483,6 +865,7 @@ func (s *MemoryStore) GetUserProblemStatuses(userID int) ([]models.UserProblemSt
 			Attempted:      ds.Attempted,
 			Solved:         ds.Solved,
 			FailedAttempts: ds.FailedAttempts,
+			BestScore:      ds.BestScore,
 			LastAttemptAt:  ds.LastAttemptAt,
 			FirstSolvedAt:  ds.FirstSolvedAt,
 			CreatedAt:      ds.CreatedAt,
@@ -496,7 +879,10 @@ func (s *MemoryStore) GetUserProblemStatuses(userID int) ([]models.UserProblemSt
 // UpdateUserProblemStatus 更新用户题目状态
 func (s *MemoryStore) UpdateUserProblemStatus(status models.UserProblemStatus) (models.UserProblemStatus, error) {
 	// 检查用户是否存在
-	if _, exists := s.users[status.UserID]; !exists {
+	s.mu.RLock()
+	_, exists := s.users[status.UserID]
+	s.mu.RUnlock()
+	if !exists {
 		return models.UserProblemStatus{}, errors.New("user not found")
 	}
 
@@ -514,6 +900,7 @@ func (s *MemoryStore) UpdateUserProblemStatus(status models.UserProblemStatus) (
 		Attempted:      status.Attempted,
 		Solved:         status.Solved,
 		FailedAttempts: status.FailedAttempts,
+		BestScore:      status.BestScore,
 		LastAttemptAt:  status.LastAttemptAt,
 		FirstSolvedAt:  status.FirstSolvedAt,
 		CreatedAt:      status.CreatedAt,
@@ -534,6 +921,7 @@ func (s *MemoryStore) UpdateUserProblemStatus(status models.UserProblemStatus) (
 		Attempted:      result.Attempted,
 		Solved:         result.Solved,
 		FailedAttempts: result.FailedAttempts,
+		BestScore:      result.BestScore,
 		LastAttemptAt:  result.LastAttemptAt,
 		FirstSolvedAt:  result.FirstSolvedAt,
 		CreatedAt:      result.CreatedAt,
@@ -543,28 +931,32 @@ func (s *MemoryStore) UpdateUserProblemStatus(status models.UserProblemStatus) (
 
 // AddOutlineQuestion 添加一个新的大纲题目
 func (s *MemoryStore) AddOutlineQuestion(question models.OutlineQuestion) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	question.ID = s.outlineQuestionCounter
-	question.CreatedAt = time.Now()
-	s.outlineQuestions[question.ID] = &question
-	s.outlineQuestionCounter++
+	err := s.update(func(save func(string)) error {
+		question.ID = s.outlineQuestionCounter
+		question.CreatedAt = time.Now()
+		s.outlineQuestions[question.ID] = &question
+		s.outlineQuestionCounter++
+		save(data.OutlineQuestionsFile)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
 	return question.ID, nil
 }
 
 // UpdateOutlineQuestion 更新现有的大纲题目
 func (s *MemoryStore) UpdateOutlineQuestion(question models.OutlineQuestion) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.outlineQuestions[question.ID]; !exists {
-		return fmt.Errorf("题目不存在: ID=%d", question.ID)
-	}
+	return s.update(func(save func(string)) error {
+		if _, exists := s.outlineQuestions[question.ID]; !exists {
+			return fmt.Errorf("题目不存在: ID=%d", question.ID)
+		}
 
-	s.outlineQuestions[question.ID] = &question
-	return nil
+		s.outlineQuestions[question.ID] = &question
+		save(data.OutlineQuestionsFile)
+		return nil
+	})
 }
 
 // GetOutlineQuestion 获取指定ID的大纲题目
@@ -640,41 +1032,45 @@ func (s *MemoryStore) GetOutlineQuestionsBySection(section string) ([]*models.Ou
 
 // DeleteOutlineQuestion 删除指定ID的大纲题目
 func (s *MemoryStore) DeleteOutlineQuestion(id int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.outlineQuestions[id]; !exists {
-		return fmt.Errorf("题目不存在: ID=%d", id)
-	}
+	return s.update(func(save func(string)) error {
+		if _, exists := s.outlineQuestions[id]; !exists {
+			return fmt.Errorf("题目不存在: ID=%d", id)
+		}
 
-	delete(s.outlineQuestions, id)
-	return nil
+		delete(s.outlineQuestions, id)
+		save(data.OutlineQuestionsFile)
+		return nil
+	})
 }
 
 // AddQuiz 添加一个新的测试
 func (s *MemoryStore) AddQuiz(quiz models.Quiz) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	quiz.ID = s.quizCounter
-	quiz.CreatedAt = time.Now()
-	s.quizzes[quiz.ID] = &quiz
-	s.quizCounter++
+	err := s.update(func(save func(string)) error {
+		quiz.ID = s.quizCounter
+		quiz.CreatedAt = time.Now()
+		s.quizzes[quiz.ID] = &quiz
+		s.quizCounter++
+		save(data.QuizzesFile)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
 	return quiz.ID, nil
 }
 
 // UpdateQuiz 更新现有的测试
 func (s *MemoryStore) UpdateQuiz(quiz models.Quiz) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.quizzes[quiz.ID]; !exists {
-		return fmt.Errorf("测试不存在: ID=%d", quiz.ID)
-	}
+	return s.update(func(save func(string)) error {
+		if _, exists := s.quizzes[quiz.ID]; !exists {
+			return fmt.Errorf("测试不存在: ID=%d", quiz.ID)
+		}
 
-	s.quizzes[quiz.ID] = &quiz
-	return nil
+		s.quizzes[quiz.ID] = &quiz
+		save(data.QuizzesFile)
+		return nil
+	})
 }
 
 // GetQuiz 获取指定ID的测试
@@ -735,26 +1131,30 @@ func (s *MemoryStore) GetQuizzesByTags(tags []string) ([]*models.Quiz, error) {
 
 // DeleteQuiz 删除指定ID的测试
 func (s *MemoryStore) DeleteQuiz(id int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.quizzes[id]; !exists {
-		return fmt.Errorf("测试不存在: ID=%d", id)
-	}
+	return s.update(func(save func(string)) error {
+		if _, exists := s.quizzes[id]; !exists {
+			return fmt.Errorf("测试不存在: ID=%d", id)
+		}
 
-	delete(s.quizzes, id)
-	return nil
+		delete(s.quizzes, id)
+		save(data.QuizzesFile)
+		return nil
+	})
 }
 
 // AddQuizSubmission 添加一个测试提交
 func (s *MemoryStore) AddQuizSubmission(submission models.QuizSubmission) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	submission.ID = s.quizSubmissionCounter
-	submission.CreatedAt = time.Now()
-	s.quizSubmissions[submission.ID] = &submission
-	s.quizSubmissionCounter++
+	err := s.update(func(save func(string)) error {
+		submission.ID = s.quizSubmissionCounter
+		submission.CreatedAt = time.Now()
+		s.quizSubmissions[submission.ID] = &submission
+		s.quizSubmissionCounter++
+		save(data.QuizSubmissionsFile)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
 	return submission.ID, nil
 }
@@ -804,13 +1204,17 @@ func (s *MemoryStore) GetQuizSubmissionsByQuestion(questionID int) ([]*models.Qu
 
 // AddQuizResult 添加一个测试结果
 func (s *MemoryStore) AddQuizResult(result models.QuizResult) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	result.ID = s.quizResultCounter
-	result.CreatedAt = time.Now()
-	s.quizResults[result.ID] = &result
-	s.quizResultCounter++
+	err := s.update(func(save func(string)) error {
+		result.ID = s.quizResultCounter
+		result.CreatedAt = time.Now()
+		s.quizResults[result.ID] = &result
+		s.quizResultCounter++
+		save(data.QuizResultsFile)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
 
 	return result.ID, nil
 }
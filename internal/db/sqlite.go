@@ -0,0 +1,1398 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/cppjudge/internal/data"
+	"github.com/user/cppjudge/internal/models"
+
+	_ "modernc.org/sqlite" // 纯Go实现的SQLite驱动，无需cgo
+)
+
+// SQLiteStore keeps all data in a SQLite database file. Each table has the
+// columns that are looked up by, and the full record as JSON in its data
+// column, so that new model fields need no schema change.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens, and if needed creates, the database at path and
+// brings its schema up to date
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	// SQLite 同一时间只允许一个写入者，使用单个连接避免 database is locked 错误
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Printf("使用SQLite数据库: %s", path)
+	return s, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// migration is a step of the database schema. Migrations are applied in
+// order and each only once; new ones must be appended, never edited.
+type migration struct {
+	name    string
+	migrate func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{"create tables", createTables},
+	{"import data files", importDataFiles},
+	{"import memory store files", importMemoryStoreFiles},
+	{"set problem updated_at", setProblemUpdatedAt},
+	{"create problem revisions", createProblemRevisions},
+	{"hash user passwords", hashUserPasswords},
+	{"use autoincrement ids", useAutoincrementIDs},
+}
+
+// migrate applies the migrations the database has not seen yet, recording
+// each in schema_migrations
+func (s *SQLiteStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("创建迁移记录表失败: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("读取数据库版本失败: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("数据库版本 %d 高于程序支持的版本 %d", current, len(migrations))
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version, m := i+1, migrations[i]
+		err := s.inTx(func(tx *sql.Tx) error {
+			if err := m.migrate(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				version, m.name, time.Now().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("数据库迁移 %d (%s) 失败: %w", version, m.name, err)
+		}
+		log.Printf("数据库迁移 %d 完成: %s", version, m.name)
+	}
+
+	return nil
+}
+
+// createTables 创建初始表结构
+func createTables(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE users (
+			id       INTEGER PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			email    TEXT NOT NULL UNIQUE,
+			password TEXT NOT NULL,
+			data     TEXT NOT NULL
+		)`,
+		`CREATE TABLE problems (
+			id   INTEGER PRIMARY KEY,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE test_cases (
+			id         INTEGER PRIMARY KEY,
+			problem_id INTEGER NOT NULL,
+			data       TEXT NOT NULL
+		)`,
+		`CREATE INDEX test_cases_problem_id ON test_cases (problem_id)`,
+		`CREATE TABLE submissions (
+			id         INTEGER PRIMARY KEY,
+			user_id    INTEGER NOT NULL,
+			problem_id INTEGER NOT NULL,
+			data       TEXT NOT NULL
+		)`,
+		`CREATE INDEX submissions_problem_id ON submissions (problem_id)`,
+		`CREATE TABLE test_results (
+			id            INTEGER PRIMARY KEY,
+			submission_id INTEGER NOT NULL,
+			test_case_id  INTEGER NOT NULL,
+			data          TEXT NOT NULL
+		)`,
+		`CREATE INDEX test_results_submission_id ON test_results (submission_id)`,
+		`CREATE TABLE user_problem_statuses (
+			id         INTEGER PRIMARY KEY,
+			user_id    INTEGER NOT NULL,
+			problem_id INTEGER NOT NULL,
+			data       TEXT NOT NULL,
+			UNIQUE (user_id, problem_id)
+		)`,
+		`CREATE TABLE outline_questions (
+			id          INTEGER PRIMARY KEY,
+			outline_ref TEXT NOT NULL,
+			data        TEXT NOT NULL
+		)`,
+		`CREATE TABLE quizzes (
+			id   INTEGER PRIMARY KEY,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE quiz_submissions (
+			id          INTEGER PRIMARY KEY,
+			user_id     INTEGER NOT NULL,
+			question_id INTEGER NOT NULL,
+			data        TEXT NOT NULL
+		)`,
+		`CREATE INDEX quiz_submissions_user_id ON quiz_submissions (user_id)`,
+		`CREATE INDEX quiz_submissions_question_id ON quiz_submissions (question_id)`,
+		`CREATE TABLE quiz_results (
+			id      INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			quiz_id INTEGER NOT NULL,
+			data    TEXT NOT NULL
+		)`,
+		`CREATE INDEX quiz_results_user_id ON quiz_results (user_id)`,
+		`CREATE INDEX quiz_results_quiz_id ON quiz_results (quiz_id)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importDataFiles 导入内存存储保存在 data 目录下的问题、测试用例与用户解题状态，
+// 保留原有ID。没有问题时与内存存储一样添加示例问题。
+// data.UserProblemStatus 与 models.UserProblemStatus 的JSON格式一致，可直接作为记录保存
+func importDataFiles(tx *sql.Tx) error {
+	problemStore := data.NewInMemoryProblemStore()
+	problems, err := problemStore.GetProblems()
+	if err != nil {
+		return err
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].ID < problems[j].ID
+	})
+
+	testCaseCount := 0
+	for _, problem := range problems {
+		if _, err := insertRecord(tx, "problems", problem.ID, problem, nil); err != nil {
+			return fmt.Errorf("导入问题 %d 失败: %w", problem.ID, err)
+		}
+
+		testCases, err := problemStore.GetTestCases(problem.ID)
+		if err != nil {
+			return err
+		}
+		for _, tc := range testCases {
+			if _, err := insertRecord(tx, "test_cases", tc.ID, tc, columns{"problem_id": problem.ID}); err != nil {
+				return fmt.Errorf("导入测试用例 %d 失败: %w", tc.ID, err)
+			}
+			testCaseCount++
+		}
+	}
+
+	persistence, err := data.NewPersistenceManager()
+	if err != nil {
+		return err
+	}
+	statusMap, err := persistence.LoadUserProblemStatuses()
+	if err != nil {
+		return err
+	}
+	statuses := make([]*data.UserProblemStatus, 0, len(statusMap))
+	for _, status := range statusMap {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	for _, status := range statuses {
+		if _, err := insertRecord(tx, "user_problem_statuses", status.ID, status,
+			columns{"user_id": status.UserID, "problem_id": status.ProblemID}); err != nil {
+			return fmt.Errorf("导入用户解题状态 %d 失败: %w", status.ID, err)
+		}
+	}
+
+	log.Printf("从数据文件导入 %d 个问题、%d 个测试用例与 %d 个用户解题状态",
+		len(problems), testCaseCount, len(statuses))
+	return nil
+}
+
+// importMemoryStoreFiles 导入内存存储保存在 data 目录下的用户、提交、测试结果与测验数据，
+// 保留原有ID。已有记录的表是SQLite存储自己写入的，不再导入
+func importMemoryStoreFiles(tx *sql.Tx) error {
+	persistence, err := data.NewPersistenceManager()
+	if err != nil {
+		return err
+	}
+
+	imports := []func() (int, error){
+		func() (int, error) {
+			return importFile(tx, persistence, data.UsersFile, "users", func(user persistedUser) (interface{}, columns) {
+				return user.User, columns{"username": user.Username, "email": user.Email, "password": user.Password}
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.SubmissionsFile, "submissions", func(submission models.Submission) (interface{}, columns) {
+				return submission, columns{"user_id": submission.UserID, "problem_id": submission.ProblemID}
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.TestResultsFile, "test_results", func(result models.TestResult) (interface{}, columns) {
+				return result, columns{"submission_id": result.SubmissionID, "test_case_id": result.TestCaseID}
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.OutlineQuestionsFile, "outline_questions", func(question models.OutlineQuestion) (interface{}, columns) {
+				return question, columns{"outline_ref": question.OutlineRef}
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.QuizzesFile, "quizzes", func(quiz models.Quiz) (interface{}, columns) {
+				return quiz, nil
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.QuizSubmissionsFile, "quiz_submissions", func(submission models.QuizSubmission) (interface{}, columns) {
+				return submission, columns{"user_id": submission.UserID, "question_id": submission.QuestionID}
+			})
+		},
+		func() (int, error) {
+			return importFile(tx, persistence, data.QuizResultsFile, "quiz_results", func(result models.QuizResult) (interface{}, columns) {
+				return result, columns{"user_id": result.UserID, "quiz_id": result.QuizID}
+			})
+		},
+	}
+
+	total := 0
+	for _, importTable := range imports {
+		n, err := importTable()
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+
+	log.Printf("从数据文件导入 %d 条用户、提交与测验记录", total)
+	return nil
+}
+
+// importFile 将数据文件中以ID为键的记录导入空表，row 返回要保存的记录及其查找列
+func importFile[T any](tx *sql.Tx, persistence *data.PersistenceManager, fileName, table string, row func(T) (interface{}, columns)) (int, error) {
+	if found, err := exists(tx, "SELECT 1 FROM "+table); err != nil || found {
+		return 0, err
+	}
+
+	var records map[int]T
+	if _, err := persistence.LoadJSON(fileName, &records); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		record, cols := row(records[id])
+		if _, err := insertRecord(tx, table, id, record, cols); err != nil {
+			return 0, fmt.Errorf("导入 %s 中的记录 %d 失败: %w", fileName, id, err)
+		}
+	}
+
+	return len(ids), nil
+}
+
+// setProblemUpdatedAt 为早期导入、没有 updated_at 的问题补上修改时间，即其创建时间
+func setProblemUpdatedAt(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE problems SET data = json_set(data, '$.updated_at', json_extract(data, '$.created_at'))
+		WHERE json_extract(data, '$.updated_at') IS NULL`)
+	return err
+}
+
+// createProblemRevisions 创建题目修订表，并导入内存存储保存的修订记录
+func createProblemRevisions(tx *sql.Tx) error {
+	if _, err := tx.Exec(`CREATE TABLE problem_revisions (
+		id         INTEGER PRIMARY KEY,
+		problem_id INTEGER NOT NULL,
+		revision   INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		UNIQUE (problem_id, revision)
+	)`); err != nil {
+		return err
+	}
+
+	persistence, err := data.NewPersistenceManager()
+	if err != nil {
+		return err
+	}
+	n, err := importFile(tx, persistence, data.ProblemRevisionsFile, "problem_revisions", func(revision models.ProblemRevision) (interface{}, columns) {
+		return revision, columns{"problem_id": revision.ProblemID, "revision": revision.Revision}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("从数据文件导入 %d 条题目修订记录", n)
+	return nil
+}
+
+// idTables 是以 id 为 INTEGER PRIMARY KEY 的表
+var idTables = []string{
+	"users", "problems", "test_cases", "submissions", "test_results", "user_problem_statuses",
+	"outline_questions", "quizzes", "quiz_submissions", "quiz_results", "problem_revisions",
+}
+
+// useAutoincrementIDs 将各表的 id 改为 INTEGER PRIMARY KEY AUTOINCREMENT 并保留原有数据与索引。
+// 没有 AUTOINCREMENT 时SQLite会重新分配删除的最大ID，使已删除题目或提交的修订记录、
+// 解题状态等关联到新记录；内存存储的ID计数器也只增不减
+func useAutoincrementIDs(tx *sql.Tx) error {
+	for _, table := range idTables {
+		var schema string
+		if err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&schema); err != nil {
+			return fmt.Errorf("读取表 %s 的结构失败: %w", table, err)
+		}
+		if strings.Contains(schema, "AUTOINCREMENT") {
+			continue
+		}
+
+		rows, err := tx.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+		if err != nil {
+			return err
+		}
+		var indexes []string
+		for rows.Next() {
+			var index string
+			if err := rows.Scan(&index); err != nil {
+				rows.Close()
+				return err
+			}
+			indexes = append(indexes, index)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// 旧表连同其索引改名后删除，再按原有语句重建索引
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s_old", table, table),
+			strings.Replace(schema, "INTEGER PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT", 1),
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s_old", table, table),
+			fmt.Sprintf("DROP TABLE %s_old", table),
+		}
+		for _, statement := range append(statements, indexes...) {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("重建表 %s 失败: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hashUserPasswords 将早先保存或从数据文件导入的明文密码替换为其bcrypt哈希
+func hashUserPasswords(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, password FROM users")
+	if err != nil {
+		return err
+	}
+	passwords := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var password string
+		if err := rows.Scan(&id, &password); err != nil {
+			rows.Close()
+			return err
+		}
+		passwords[id] = password
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	hashed := 0
+	for id, password := range passwords {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		if hash == password {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", hash, id); err != nil {
+			return err
+		}
+		hashed++
+	}
+
+	log.Printf("为 %d 个用户的密码计算哈希", hashed)
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// columns holds the values of a table's lookup columns, besides id and data
+type columns map[string]interface{}
+
+// inTx runs fn in a transaction, committing it if fn succeeds
+func (s *SQLiteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertRecord adds a row holding record as JSON and returns its ID. With id
+// 0 the database assigns the next free ID, which is then also written into
+// the record's id field.
+func insertRecord(q queryer, table string, id int, record interface{}, cols columns) (int, error) {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+
+	names := []string{"id", "data"}
+	var rowID interface{} // NULL lets SQLite pick the ID
+	if id != 0 {
+		rowID = id
+	}
+	args := []interface{}{rowID, string(recordJSON)}
+	for name, value := range cols {
+		names = append(names, name)
+		args = append(args, value)
+	}
+
+	result, err := q.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)",
+		table, strings.Join(names, ", "), strings.Repeat(", ?", len(names)-1)), args...)
+	if err != nil {
+		return 0, err
+	}
+	if id != 0 {
+		return id, nil
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := q.Exec(fmt.Sprintf("UPDATE %s SET data = json_set(data, '$.id', id) WHERE id = ?", table), newID); err != nil {
+		return 0, err
+	}
+	return int(newID), nil
+}
+
+// updateRecord replaces the row with the given ID, reporting whether it exists
+func updateRecord(q queryer, table string, id int, record interface{}, cols columns) (bool, error) {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+
+	assignments := []string{"data = ?"}
+	args := []interface{}{string(recordJSON)}
+	for name, value := range cols {
+		assignments = append(assignments, name+" = ?")
+		args = append(args, value)
+	}
+	args = append(args, id)
+
+	result, err := q.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(assignments, ", ")), args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// getRecord reads the record of the row with the given ID, reporting whether
+// it exists
+func getRecord(q queryer, table string, id int, record interface{}) (bool, error) {
+	var recordJSON string
+	err := q.QueryRow(fmt.Sprintf("SELECT data FROM %s WHERE id = ?", table), id).Scan(&recordJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(recordJSON), record)
+}
+
+// queryRecords runs a query selecting the data column and decodes each row
+func queryRecords[T any](q queryer, query string, args ...interface{}) ([]T, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]T, 0)
+	for rows.Next() {
+		var recordJSON string
+		if err := rows.Scan(&recordJSON); err != nil {
+			return nil, err
+		}
+		var record T
+		if err := json.Unmarshal([]byte(recordJSON), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// exists reports whether a query returns any row
+func exists(q queryer, query string, args ...interface{}) (bool, error) {
+	var found bool
+	err := q.QueryRow("SELECT EXISTS ("+query+")", args...).Scan(&found)
+	return found, err
+}
+
+// hasAnyTag reports whether any of tags is among the record's tags
+func hasAnyTag(recordTags, tags []string) bool {
+	for _, tag := range tags {
+		for _, recordTag := range recordTags {
+			if recordTag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddUser adds a new user to the store
+func (s *SQLiteStore) AddUser(user models.User) (models.User, error) {
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.Password = hash
+
+	err = s.inTx(func(tx *sql.Tx) error {
+		if found, err := exists(tx, "SELECT 1 FROM users WHERE username = ?", user.Username); err != nil {
+			return err
+		} else if found {
+			return errors.New("username already exists")
+		}
+		if found, err := exists(tx, "SELECT 1 FROM users WHERE email = ?", user.Email); err != nil {
+			return err
+		} else if found {
+			return errors.New("email already exists")
+		}
+
+		user.ID = 0
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = time.Now()
+		id, err := insertRecord(tx, "users", 0, user,
+			columns{"username": user.Username, "email": user.Email, "password": user.Password})
+		user.ID = id
+		return err
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// getUser reads a user and its password, which is not part of the record
+func (s *SQLiteStore) getUser(where string, arg interface{}) (models.User, error) {
+	var recordJSON, password string
+	err := s.db.QueryRow("SELECT data, password FROM users WHERE "+where, arg).Scan(&recordJSON, &password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, errors.New("user not found")
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	if err := json.Unmarshal([]byte(recordJSON), &user); err != nil {
+		return models.User{}, err
+	}
+	user.Password = password
+	return user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (s *SQLiteStore) GetUserByID(id int) (models.User, error) {
+	return s.getUser("id = ?", id)
+}
+
+// GetUserByUsername retrieves a user by username
+func (s *SQLiteStore) GetUserByUsername(username string) (models.User, error) {
+	return s.getUser("username = ?", username)
+}
+
+// AddProblem adds a new problem
+func (s *SQLiteStore) AddProblem(problem models.Problem) (models.Problem, error) {
+	problem.ID = 0
+	problem.CreatedAt = time.Now()
+	problem.UpdatedAt = problem.CreatedAt
+
+	id, err := insertRecord(s.db, "problems", 0, problem, nil)
+	if err != nil {
+		return models.Problem{}, err
+	}
+	problem.ID = id
+
+	return problem, nil
+}
+
+// GetProblemByID retrieves a problem by ID
+func (s *SQLiteStore) GetProblemByID(id int) (models.Problem, error) {
+	var problem models.Problem
+	found, err := getRecord(s.db, "problems", id, &problem)
+	if err != nil {
+		return models.Problem{}, err
+	}
+	if !found {
+		return models.Problem{}, data.ErrNotFound
+	}
+
+	return problem, nil
+}
+
+// UpdateProblem replaces a problem, keeping its creation time
+func (s *SQLiteStore) UpdateProblem(problem models.Problem) (models.Problem, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		var existing models.Problem
+		found, err := getRecord(tx, "problems", problem.ID, &existing)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return data.ErrNotFound
+		}
+
+		problem.CreatedAt = existing.CreatedAt
+		problem.UpdatedAt = time.Now()
+		_, err = updateRecord(tx, "problems", problem.ID, problem, nil)
+		return err
+	})
+	if err != nil {
+		return models.Problem{}, err
+	}
+
+	return problem, nil
+}
+
+// DeleteProblem removes a problem together with its test cases, its
+// submissions and their test results, its revisions, and the users' statuses
+// on it. The check for submissions being judged is in the same transaction.
+func (s *SQLiteStore) DeleteProblem(id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if found, err := exists(tx, "SELECT 1 FROM problems WHERE id = ?", id); err != nil {
+			return err
+		} else if !found {
+			return data.ErrNotFound
+		}
+		judging, err := exists(tx, `SELECT 1 FROM submissions WHERE problem_id = ?
+			AND json_extract(data, '$.status') IN ('Pending', 'Testing')`, id)
+		if err != nil {
+			return err
+		}
+		if judging {
+			return ErrProblemJudging
+		}
+
+		statements := []string{
+			"DELETE FROM problems WHERE id = ?",
+			"DELETE FROM test_results WHERE submission_id IN (SELECT id FROM submissions WHERE problem_id = ?)",
+			"DELETE FROM submissions WHERE problem_id = ?",
+			"DELETE FROM test_cases WHERE problem_id = ?",
+			"DELETE FROM user_problem_statuses WHERE problem_id = ?",
+			"DELETE FROM problem_revisions WHERE problem_id = ?",
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListProblems returns all problems, newest first
+func (s *SQLiteStore) ListProblems() []models.Problem {
+	problems, err := queryRecords[models.Problem](s.db, "SELECT data FROM problems ORDER BY id DESC")
+	if err != nil {
+		log.Printf("读取问题列表失败: %v", err)
+		return []models.Problem{}
+	}
+
+	return problems
+}
+
+// ImportProblems adds problems together with their test cases, which are
+// keyed by the problem's index in problems
+func (s *SQLiteStore) ImportProblems(problems []models.Problem, testCases map[int][]models.TestCase) ([]int, error) {
+	importedIDs := make([]int, 0, len(problems))
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		for i, problem := range problems {
+			problem.ID = 0
+			problem.CreatedAt = time.Now()
+			problem.UpdatedAt = problem.CreatedAt
+			problemID, err := insertRecord(tx, "problems", 0, problem, nil)
+			if err != nil {
+				return err
+			}
+			importedIDs = append(importedIDs, problemID)
+
+			for _, tc := range testCases[i] {
+				tc.ID = 0
+				tc.ProblemID = problemID
+				if _, err := insertRecord(tx, "test_cases", 0, tc, columns{"problem_id": problemID}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("完成导入 %d 个问题", len(importedIDs))
+	return importedIDs, nil
+}
+
+// AddTestCase adds a new test case
+func (s *SQLiteStore) AddTestCase(testCase models.TestCase) (models.TestCase, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if found, err := exists(tx, "SELECT 1 FROM problems WHERE id = ?", testCase.ProblemID); err != nil {
+			return err
+		} else if !found {
+			return data.ErrNotFound
+		}
+
+		id, err := insertRecord(tx, "test_cases", 0, testCase, columns{"problem_id": testCase.ProblemID})
+		testCase.ID = id
+		return err
+	})
+	if err != nil {
+		return models.TestCase{}, err
+	}
+
+	return testCase, nil
+}
+
+// GetTestCasesByProblemID retrieves all test cases for a problem
+func (s *SQLiteStore) GetTestCasesByProblemID(problemID int) ([]models.TestCase, error) {
+	return queryRecords[models.TestCase](s.db, "SELECT data FROM test_cases WHERE problem_id = ? ORDER BY id", problemID)
+}
+
+// UpdateTestCase replaces a test case of the problem given by its ProblemID
+func (s *SQLiteStore) UpdateTestCase(testCase models.TestCase) (models.TestCase, error) {
+	recordJSON, err := json.Marshal(testCase)
+	if err != nil {
+		return models.TestCase{}, err
+	}
+	result, err := s.db.Exec("UPDATE test_cases SET data = ? WHERE id = ? AND problem_id = ?",
+		string(recordJSON), testCase.ID, testCase.ProblemID)
+	if err != nil {
+		return models.TestCase{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return models.TestCase{}, err
+	} else if n == 0 {
+		return models.TestCase{}, ErrTestCaseNotFound
+	}
+
+	return testCase, nil
+}
+
+// DeleteTestCase removes a test case from a problem. Results of finished
+// submissions on it are kept until they are rejudged.
+func (s *SQLiteStore) DeleteTestCase(problemID, testCaseID int) error {
+	result, err := s.db.Exec("DELETE FROM test_cases WHERE id = ? AND problem_id = ?", testCaseID, problemID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTestCaseNotFound
+	}
+
+	return nil
+}
+
+// ReloadTestCases is not supported: test cases live in the database, and
+// nothing keeps the data directory's testcases.json in step with it
+func (s *SQLiteStore) ReloadTestCases(problemID int) (int, error) {
+	return 0, ErrReloadUnsupported
+}
+
+// RestoreProblem replaces a problem and all its test cases in one
+// transaction, keeping the problem's creation time and the test cases' IDs
+// unless another problem uses them
+func (s *SQLiteStore) RestoreProblem(problem models.Problem, testCases []models.TestCase) (models.Problem, []models.TestCase, error) {
+	result := make([]models.TestCase, 0, len(testCases))
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		var existing models.Problem
+		found, err := getRecord(tx, "problems", problem.ID, &existing)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return data.ErrNotFound
+		}
+		problem.CreatedAt = existing.CreatedAt
+		problem.UpdatedAt = time.Now()
+		if _, err := updateRecord(tx, "problems", problem.ID, problem, nil); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM test_cases WHERE problem_id = ?", problem.ID); err != nil {
+			return err
+		}
+		for _, tc := range testCases {
+			tc.ProblemID = problem.ID
+			if tc.ID != 0 {
+				if used, err := exists(tx, "SELECT 1 FROM test_cases WHERE id = ?", tc.ID); err != nil {
+					return err
+				} else if used {
+					tc.ID = 0
+				}
+			}
+			id, err := insertRecord(tx, "test_cases", tc.ID, tc, columns{"problem_id": problem.ID})
+			if err != nil {
+				return fmt.Errorf("保存测试用例 %d 失败: %w", tc.ID, err)
+			}
+			tc.ID = id
+			result = append(result, tc)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Problem{}, nil, err
+	}
+
+	log.Printf("恢复问题 %d, 测试用例 %d 个", problem.ID, len(result))
+	return problem, result, nil
+}
+
+// AddProblemRevision records a revision of a problem, numbered after its
+// latest one
+func (s *SQLiteStore) AddProblemRevision(revision models.ProblemRevision) (models.ProblemRevision, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if found, err := exists(tx, "SELECT 1 FROM problems WHERE id = ?", revision.ProblemID); err != nil {
+			return err
+		} else if !found {
+			return errors.New("problem not found")
+		}
+
+		if err := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) + 1 FROM problem_revisions WHERE problem_id = ?",
+			revision.ProblemID).Scan(&revision.Revision); err != nil {
+			return err
+		}
+		revision.ID = 0
+		revision.CreatedAt = time.Now()
+		id, err := insertRecord(tx, "problem_revisions", 0, revision,
+			columns{"problem_id": revision.ProblemID, "revision": revision.Revision})
+		revision.ID = id
+		return err
+	})
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+
+	return revision, nil
+}
+
+// GetProblemRevisions returns the revisions of a problem, oldest first
+func (s *SQLiteStore) GetProblemRevisions(problemID int) ([]models.ProblemRevision, error) {
+	return queryRecords[models.ProblemRevision](s.db,
+		"SELECT data FROM problem_revisions WHERE problem_id = ? ORDER BY revision", problemID)
+}
+
+// GetProblemRevision retrieves a revision of a problem by its number
+func (s *SQLiteStore) GetProblemRevision(problemID, revision int) (models.ProblemRevision, error) {
+	revisions, err := queryRecords[models.ProblemRevision](s.db,
+		"SELECT data FROM problem_revisions WHERE problem_id = ? AND revision = ?", problemID, revision)
+	if err != nil {
+		return models.ProblemRevision{}, err
+	}
+	if len(revisions) == 0 {
+		return models.ProblemRevision{}, errors.New("revision not found")
+	}
+
+	return revisions[0], nil
+}
+
+// GetLatestProblemRevision returns the number of a problem's latest revision,
+// or 0 if it has none
+func (s *SQLiteStore) GetLatestProblemRevision(problemID int) (int, error) {
+	var latest int
+	err := s.db.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM problem_revisions WHERE problem_id = ?", problemID).Scan(&latest)
+	return latest, err
+}
+
+// AddSubmission adds a new submission
+func (s *SQLiteStore) AddSubmission(submission models.Submission) (models.Submission, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", submission.UserID); err != nil {
+			return err
+		} else if !found {
+			return errors.New("user not found")
+		}
+		if found, err := exists(tx, "SELECT 1 FROM problems WHERE id = ?", submission.ProblemID); err != nil {
+			return err
+		} else if !found {
+			return errors.New("problem not found")
+		}
+
+		submission.ID = 0
+		submission.CreatedAt = time.Now()
+		submission.SubmittedAt = time.Now()
+		id, err := insertRecord(tx, "submissions", 0, submission,
+			columns{"user_id": submission.UserID, "problem_id": submission.ProblemID})
+		submission.ID = id
+		return err
+	})
+	if err != nil {
+		return models.Submission{}, err
+	}
+
+	return submission, nil
+}
+
+// GetSubmissionByID retrieves a submission by ID
+func (s *SQLiteStore) GetSubmissionByID(id int) (models.Submission, error) {
+	var submission models.Submission
+	found, err := getRecord(s.db, "submissions", id, &submission)
+	if err != nil {
+		return models.Submission{}, err
+	}
+	if !found {
+		return models.Submission{}, ErrSubmissionNotFound
+	}
+
+	return submission, nil
+}
+
+// UpdateSubmission updates a submission
+func (s *SQLiteStore) UpdateSubmission(submission models.Submission) error {
+	found, err := updateRecord(s.db, "submissions", submission.ID, submission,
+		columns{"user_id": submission.UserID, "problem_id": submission.ProblemID})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSubmissionNotFound
+	}
+
+	return nil
+}
+
+// GetSubmissionsByProblemID retrieves all submissions of a problem, oldest first
+func (s *SQLiteStore) GetSubmissionsByProblemID(problemID int) []models.Submission {
+	submissions, err := queryRecords[models.Submission](s.db, "SELECT data FROM submissions WHERE problem_id = ? ORDER BY id", problemID)
+	if err != nil {
+		log.Printf("读取问题 %d 的提交失败: %v", problemID, err)
+		return []models.Submission{}
+	}
+
+	return submissions
+}
+
+// GetJudgingSubmissions returns the submissions waiting or being judged, oldest first
+func (s *SQLiteStore) GetJudgingSubmissions() ([]models.Submission, error) {
+	return queryRecords[models.Submission](s.db,
+		"SELECT data FROM submissions WHERE json_extract(data, '$.status') IN ('Pending', 'Testing') ORDER BY id")
+}
+
+// AddTestResult adds a new test result
+func (s *SQLiteStore) AddTestResult(result models.TestResult) (models.TestResult, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		var problemID int
+		err := tx.QueryRow("SELECT problem_id FROM submissions WHERE id = ?", result.SubmissionID).Scan(&problemID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSubmissionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if found, err := exists(tx, "SELECT 1 FROM test_cases WHERE id = ? AND problem_id = ?", result.TestCaseID, problemID); err != nil {
+			return err
+		} else if !found {
+			return ErrTestCaseNotFound
+		}
+
+		id, err := insertRecord(tx, "test_results", 0, result,
+			columns{"submission_id": result.SubmissionID, "test_case_id": result.TestCaseID})
+		result.ID = id
+		return err
+	})
+	if err != nil {
+		return models.TestResult{}, err
+	}
+
+	return result, nil
+}
+
+// GetTestResultsBySubmissionID retrieves all test results for a submission
+func (s *SQLiteStore) GetTestResultsBySubmissionID(submissionID int) ([]models.TestResult, error) {
+	if found, err := exists(s.db, "SELECT 1 FROM submissions WHERE id = ?", submissionID); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, ErrSubmissionNotFound
+	}
+
+	return queryRecords[models.TestResult](s.db, "SELECT data FROM test_results WHERE submission_id = ? ORDER BY id", submissionID)
+}
+
+// DeleteTestResultsBySubmissionID removes all test results of a submission
+func (s *SQLiteStore) DeleteTestResultsBySubmissionID(submissionID int) error {
+	if found, err := exists(s.db, "SELECT 1 FROM submissions WHERE id = ?", submissionID); err != nil {
+		return err
+	} else if !found {
+		return ErrSubmissionNotFound
+	}
+
+	_, err := s.db.Exec("DELETE FROM test_results WHERE submission_id = ?", submissionID)
+	return err
+}
+
+// checkUserAndProblem 检查用户与问题是否存在
+func (s *SQLiteStore) checkUserAndProblem(q queryer, userID, problemID int) error {
+	if found, err := exists(q, "SELECT 1 FROM users WHERE id = ?", userID); err != nil {
+		return err
+	} else if !found {
+		return errors.New("user not found")
+	}
+	if found, err := exists(q, "SELECT 1 FROM problems WHERE id = ?", problemID); err != nil {
+		return err
+	} else if !found {
+		return errors.New("problem not found")
+	}
+	return nil
+}
+
+// getUserProblemStatus 读取用户题目状态，不存在时 found 为 false
+func getUserProblemStatus(q queryer, userID, problemID int) (status models.UserProblemStatus, found bool, err error) {
+	statuses, err := queryRecords[models.UserProblemStatus](q,
+		"SELECT data FROM user_problem_statuses WHERE user_id = ? AND problem_id = ?", userID, problemID)
+	if err != nil || len(statuses) == 0 {
+		return models.UserProblemStatus{}, false, err
+	}
+	return statuses[0], true, nil
+}
+
+// GetUserProblemStatus 获取用户对特定问题的状态
+func (s *SQLiteStore) GetUserProblemStatus(userID, problemID int) (models.UserProblemStatus, error) {
+	if err := s.checkUserAndProblem(s.db, userID, problemID); err != nil {
+		return models.UserProblemStatus{}, err
+	}
+
+	status, found, err := getUserProblemStatus(s.db, userID, problemID)
+	if err != nil {
+		return models.UserProblemStatus{}, err
+	}
+	if !found {
+		// 如果状态不存在，返回一个新的空状态
+		return models.UserProblemStatus{
+			UserID:    userID,
+			ProblemID: problemID,
+		}, nil
+	}
+
+	return status, nil
+}
+
+// GetUserProblemStatuses 获取用户所有题目的状态
+func (s *SQLiteStore) GetUserProblemStatuses(userID int) ([]models.UserProblemStatus, error) {
+	if found, err := exists(s.db, "SELECT 1 FROM users WHERE id = ?", userID); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, errors.New("user not found")
+	}
+
+	return queryRecords[models.UserProblemStatus](s.db, "SELECT data FROM user_problem_statuses WHERE user_id = ? ORDER BY id", userID)
+}
+
+// UpdateUserProblemStatus 更新用户题目状态，不存在时创建
+func (s *SQLiteStore) UpdateUserProblemStatus(status models.UserProblemStatus) (models.UserProblemStatus, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := s.checkUserAndProblem(tx, status.UserID, status.ProblemID); err != nil {
+			return err
+		}
+
+		existing, found, err := getUserProblemStatus(tx, status.UserID, status.ProblemID)
+		if err != nil {
+			return err
+		}
+
+		cols := columns{"user_id": status.UserID, "problem_id": status.ProblemID}
+		if found {
+			status.ID = existing.ID
+			status.CreatedAt = existing.CreatedAt
+			status.UpdatedAt = time.Now()
+			_, err = updateRecord(tx, "user_problem_statuses", status.ID, status, cols)
+			return err
+		}
+
+		status.ID = 0
+		status.CreatedAt = time.Now()
+		status.UpdatedAt = time.Now()
+		status.ID, err = insertRecord(tx, "user_problem_statuses", 0, status, cols)
+		return err
+	})
+	if err != nil {
+		return models.UserProblemStatus{}, err
+	}
+
+	return status, nil
+}
+
+// AddOutlineQuestion 添加一个新的大纲题目
+func (s *SQLiteStore) AddOutlineQuestion(question models.OutlineQuestion) (int, error) {
+	question.ID = 0
+	question.CreatedAt = time.Now()
+	return insertRecord(s.db, "outline_questions", 0, question, columns{"outline_ref": question.OutlineRef})
+}
+
+// UpdateOutlineQuestion 更新现有的大纲题目
+func (s *SQLiteStore) UpdateOutlineQuestion(question models.OutlineQuestion) error {
+	found, err := updateRecord(s.db, "outline_questions", question.ID, question, columns{"outline_ref": question.OutlineRef})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("题目不存在: ID=%d", question.ID)
+	}
+
+	return nil
+}
+
+// GetOutlineQuestion 获取指定ID的大纲题目
+func (s *SQLiteStore) GetOutlineQuestion(id int) (*models.OutlineQuestion, error) {
+	var question models.OutlineQuestion
+	found, err := getRecord(s.db, "outline_questions", id, &question)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("题目不存在: ID=%d", id)
+	}
+
+	return &question, nil
+}
+
+// GetAllOutlineQuestions 获取所有大纲题目
+func (s *SQLiteStore) GetAllOutlineQuestions() ([]*models.OutlineQuestion, error) {
+	return queryRecords[*models.OutlineQuestion](s.db, "SELECT data FROM outline_questions ORDER BY id")
+}
+
+// GetOutlineQuestionsByTags 根据标签获取大纲题目，包含任何一个标签即可
+func (s *SQLiteStore) GetOutlineQuestionsByTags(tags []string) ([]*models.OutlineQuestion, error) {
+	questions, err := s.GetAllOutlineQuestions()
+	if err != nil || len(tags) == 0 {
+		return questions, err
+	}
+
+	matched := make([]*models.OutlineQuestion, 0)
+	for _, question := range questions {
+		if hasAnyTag(question.KnowledgeTag, tags) {
+			matched = append(matched, question)
+		}
+	}
+
+	return matched, nil
+}
+
+// GetOutlineQuestionsBySection 根据大纲章节获取题目
+func (s *SQLiteStore) GetOutlineQuestionsBySection(section string) ([]*models.OutlineQuestion, error) {
+	return queryRecords[*models.OutlineQuestion](s.db,
+		"SELECT data FROM outline_questions WHERE substr(outline_ref, 1, length(?1)) = ?1 ORDER BY id", section)
+}
+
+// DeleteOutlineQuestion 删除指定ID的大纲题目
+func (s *SQLiteStore) DeleteOutlineQuestion(id int) error {
+	result, err := s.db.Exec("DELETE FROM outline_questions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("题目不存在: ID=%d", id)
+	}
+
+	return nil
+}
+
+// AddQuiz 添加一个新的测试
+func (s *SQLiteStore) AddQuiz(quiz models.Quiz) (int, error) {
+	quiz.ID = 0
+	quiz.CreatedAt = time.Now()
+	return insertRecord(s.db, "quizzes", 0, quiz, nil)
+}
+
+// UpdateQuiz 更新现有的测试
+func (s *SQLiteStore) UpdateQuiz(quiz models.Quiz) error {
+	found, err := updateRecord(s.db, "quizzes", quiz.ID, quiz, nil)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("测试不存在: ID=%d", quiz.ID)
+	}
+
+	return nil
+}
+
+// GetQuiz 获取指定ID的测试
+func (s *SQLiteStore) GetQuiz(id int) (*models.Quiz, error) {
+	var quiz models.Quiz
+	found, err := getRecord(s.db, "quizzes", id, &quiz)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("测试不存在: ID=%d", id)
+	}
+
+	return &quiz, nil
+}
+
+// GetAllQuizzes 获取所有测试
+func (s *SQLiteStore) GetAllQuizzes() ([]*models.Quiz, error) {
+	return queryRecords[*models.Quiz](s.db, "SELECT data FROM quizzes ORDER BY id")
+}
+
+// GetQuizzesByTags 根据标签获取测试，包含任何一个标签即可
+func (s *SQLiteStore) GetQuizzesByTags(tags []string) ([]*models.Quiz, error) {
+	quizzes, err := s.GetAllQuizzes()
+	if err != nil || len(tags) == 0 {
+		return quizzes, err
+	}
+
+	matched := make([]*models.Quiz, 0)
+	for _, quiz := range quizzes {
+		if hasAnyTag(quiz.KnowledgeTag, tags) {
+			matched = append(matched, quiz)
+		}
+	}
+
+	return matched, nil
+}
+
+// DeleteQuiz 删除指定ID的测试
+func (s *SQLiteStore) DeleteQuiz(id int) error {
+	result, err := s.db.Exec("DELETE FROM quizzes WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("测试不存在: ID=%d", id)
+	}
+
+	return nil
+}
+
+// AddQuizSubmission 添加一个测试提交
+func (s *SQLiteStore) AddQuizSubmission(submission models.QuizSubmission) (int, error) {
+	submission.ID = 0
+	submission.CreatedAt = time.Now()
+	return insertRecord(s.db, "quiz_submissions", 0, submission,
+		columns{"user_id": submission.UserID, "question_id": submission.QuestionID})
+}
+
+// GetQuizSubmission 获取指定ID的测试提交
+func (s *SQLiteStore) GetQuizSubmission(id int) (*models.QuizSubmission, error) {
+	var submission models.QuizSubmission
+	found, err := getRecord(s.db, "quiz_submissions", id, &submission)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("测试提交不存在: ID=%d", id)
+	}
+
+	return &submission, nil
+}
+
+// GetQuizSubmissionsByUser 获取指定用户的所有测试提交
+func (s *SQLiteStore) GetQuizSubmissionsByUser(userID int) ([]*models.QuizSubmission, error) {
+	return queryRecords[*models.QuizSubmission](s.db, "SELECT data FROM quiz_submissions WHERE user_id = ? ORDER BY id", userID)
+}
+
+// GetQuizSubmissionsByQuestion 获取指定题目的所有测试提交
+func (s *SQLiteStore) GetQuizSubmissionsByQuestion(questionID int) ([]*models.QuizSubmission, error) {
+	return queryRecords[*models.QuizSubmission](s.db, "SELECT data FROM quiz_submissions WHERE question_id = ? ORDER BY id", questionID)
+}
+
+// AddQuizResult 添加一个测试结果
+func (s *SQLiteStore) AddQuizResult(result models.QuizResult) (int, error) {
+	result.ID = 0
+	result.CreatedAt = time.Now()
+	return insertRecord(s.db, "quiz_results", 0, result,
+		columns{"user_id": result.UserID, "quiz_id": result.QuizID})
+}
+
+// GetQuizResult 获取指定ID的测试结果
+func (s *SQLiteStore) GetQuizResult(id int) (*models.QuizResult, error) {
+	var result models.QuizResult
+	found, err := getRecord(s.db, "quiz_results", id, &result)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("测试结果不存在: ID=%d", id)
+	}
+
+	return &result, nil
+}
+
+// GetQuizResultsByUser 获取指定用户的所有测试结果
+func (s *SQLiteStore) GetQuizResultsByUser(userID int) ([]*models.QuizResult, error) {
+	return queryRecords[*models.QuizResult](s.db, "SELECT data FROM quiz_results WHERE user_id = ? ORDER BY id", userID)
+}
+
+// GetQuizResultsByQuiz 获取指定测试的所有结果
+func (s *SQLiteStore) GetQuizResultsByQuiz(quizID int) ([]*models.QuizResult, error) {
+	return queryRecords[*models.QuizResult](s.db, "SELECT data FROM quiz_results WHERE quiz_id = ? ORDER BY id", quizID)
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/user/cppjudge/internal/data"
+	"github.com/user/cppjudge/internal/models"
+)
+
+// Store errors. ErrSubmissionNotFound and ErrTestCaseNotFound wrap
+// data.ErrNotFound, so that missing submissions, test cases or problems can be
+// told apart from other failures.
+var (
+	ErrSubmissionNotFound = fmt.Errorf("submission %w", data.ErrNotFound)
+	ErrTestCaseNotFound   = fmt.Errorf("test case %w", data.ErrNotFound)
+	ErrProblemJudging     = errors.New("problem has submissions waiting or being judged")
+	ErrReloadUnsupported  = errors.New("reloading test cases from the data files is only supported by the memory store")
+)
+
+// isJudging reports whether a submission status means it is still waiting or
+// being judged, as judge.StatusPending and judge.StatusTesting
+func isJudging(status string) bool {
+	return status == "Pending" || status == "Testing"
+}
+
+// hashPassword returns the bcrypt hash of a password. Stores keep only the
+// hash; one that is already a bcrypt hash is returned unchanged.
+func hashPassword(password string) (string, error) {
+	if _, err := bcrypt.Cost([]byte(password)); err == nil {
+		return password, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Store is the storage used by the judge and the API. MemoryStore keeps
+// everything in memory and saves it to JSON files in the data directory;
+// SQLiteStore keeps everything in a SQLite database file.
+type Store interface {
+	// Users. AddUser stores the bcrypt hash of the user's password.
+	AddUser(user models.User) (models.User, error)
+	GetUserByID(id int) (models.User, error)
+	GetUserByUsername(username string) (models.User, error)
+
+	// Problems and test cases
+	AddProblem(problem models.Problem) (models.Problem, error)
+	GetProblemByID(id int) (models.Problem, error)
+	ListProblems() []models.Problem
+	UpdateProblem(problem models.Problem) (models.Problem, error)
+	// DeleteProblem fails with ErrProblemJudging while any of the problem's
+	// submissions is waiting or being judged
+	DeleteProblem(id int) error
+	ImportProblems(problems []models.Problem, testCases map[int][]models.TestCase) ([]int, error)
+	AddTestCase(testCase models.TestCase) (models.TestCase, error)
+	GetTestCasesByProblemID(problemID int) ([]models.TestCase, error)
+	UpdateTestCase(testCase models.TestCase) (models.TestCase, error)
+	DeleteTestCase(problemID, testCaseID int) error
+	// ReloadTestCases re-reads a problem's test cases from the data files;
+	// stores that do not keep them there return ErrReloadUnsupported
+	ReloadTestCases(problemID int) (int, error)
+	RestoreProblem(problem models.Problem, testCases []models.TestCase) (models.Problem, []models.TestCase, error)
+
+	// 题目修订记录
+	AddProblemRevision(revision models.ProblemRevision) (models.ProblemRevision, error)
+	GetProblemRevisions(problemID int) ([]models.ProblemRevision, error)
+	GetProblemRevision(problemID, revision int) (models.ProblemRevision, error)
+	GetLatestProblemRevision(problemID int) (int, error)
+
+	// Submissions and test results
+	AddSubmission(submission models.Submission) (models.Submission, error)
+	GetSubmissionByID(id int) (models.Submission, error)
+	UpdateSubmission(submission models.Submission) error
+	GetSubmissionsByProblemID(problemID int) []models.Submission
+	// GetJudgingSubmissions returns the submissions waiting or being judged,
+	// oldest first, such as those left so when the server stopped
+	GetJudgingSubmissions() ([]models.Submission, error)
+	AddTestResult(result models.TestResult) (models.TestResult, error)
+	GetTestResultsBySubmissionID(submissionID int) ([]models.TestResult, error)
+	DeleteTestResultsBySubmissionID(submissionID int) error
+
+	// 用户解题状态
+	GetUserProblemStatus(userID, problemID int) (models.UserProblemStatus, error)
+	GetUserProblemStatuses(userID int) ([]models.UserProblemStatus, error)
+	UpdateUserProblemStatus(status models.UserProblemStatus) (models.UserProblemStatus, error)
+
+	// 大纲题目
+	AddOutlineQuestion(question models.OutlineQuestion) (int, error)
+	UpdateOutlineQuestion(question models.OutlineQuestion) error
+	GetOutlineQuestion(id int) (*models.OutlineQuestion, error)
+	GetAllOutlineQuestions() ([]*models.OutlineQuestion, error)
+	GetOutlineQuestionsByTags(tags []string) ([]*models.OutlineQuestion, error)
+	GetOutlineQuestionsBySection(section string) ([]*models.OutlineQuestion, error)
+	DeleteOutlineQuestion(id int) error
+
+	// 测试、测试提交与测试结果
+	AddQuiz(quiz models.Quiz) (int, error)
+	UpdateQuiz(quiz models.Quiz) error
+	GetQuiz(id int) (*models.Quiz, error)
+	GetAllQuizzes() ([]*models.Quiz, error)
+	GetQuizzesByTags(tags []string) ([]*models.Quiz, error)
+	DeleteQuiz(id int) error
+	AddQuizSubmission(submission models.QuizSubmission) (int, error)
+	GetQuizSubmission(id int) (*models.QuizSubmission, error)
+	GetQuizSubmissionsByUser(userID int) ([]*models.QuizSubmission, error)
+	GetQuizSubmissionsByQuestion(questionID int) ([]*models.QuizSubmission, error)
+	AddQuizResult(result models.QuizResult) (int, error)
+	GetQuizResult(id int) (*models.QuizResult, error)
+	GetQuizResultsByUser(userID int) ([]*models.QuizResult, error)
+	GetQuizResultsByQuiz(quizID int) ([]*models.QuizResult, error)
+
+	// Close releases the store's resources
+	Close() error
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
@@ -0,0 +1,401 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/user/cppjudge/internal/data"
+	"github.com/user/cppjudge/internal/models"
+)
+
+// chdirTemp runs the rest of a test in a temporary working directory, where
+// the stores keep their data files
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// openSQLite opens a SQLite store in the working directory, closed when the
+// test ends
+func openSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore("cppjudge.db")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// forEachStore runs a test against each Store implementation, each in a fresh
+// working directory
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+		{"sqlite", func(t *testing.T) Store { return openSQLite(t) }},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			chdirTemp(t)
+			test(t, backend.open(t))
+		})
+	}
+}
+
+// addProblem adds a problem with one example and one hidden test case
+func addProblem(t *testing.T, store Store, title string) (models.Problem, []models.TestCase) {
+	t.Helper()
+
+	problem, err := store.AddProblem(models.Problem{Title: title, Description: "test", TimeLimit: 1000, MemoryLimit: 65536})
+	if err != nil {
+		t.Fatalf("AddProblem: %v", err)
+	}
+	var testCases []models.TestCase
+	for _, tc := range []models.TestCase{
+		{ProblemID: problem.ID, Input: "1 2\n", Output: "3\n", IsExample: true},
+		{ProblemID: problem.ID, Input: "2 2\n", Output: "4\n"},
+	} {
+		added, err := store.AddTestCase(tc)
+		if err != nil {
+			t.Fatalf("AddTestCase: %v", err)
+		}
+		testCases = append(testCases, added)
+	}
+	return problem, testCases
+}
+
+// addSubmission adds a submission with the given status
+func addSubmission(t *testing.T, store Store, userID, problemID int, status string) models.Submission {
+	t.Helper()
+
+	submission, err := store.AddSubmission(models.Submission{
+		UserID: userID, ProblemID: problemID, Code: "int main() {}", Language: "cpp17", Status: status,
+	})
+	if err != nil {
+		t.Fatalf("AddSubmission: %v", err)
+	}
+	return submission
+}
+
+func TestStoreUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		user, err := store.AddUser(models.User{Username: "alice", Email: "alice@example.com", Password: "secret"})
+		if err != nil {
+			t.Fatalf("AddUser: %v", err)
+		}
+
+		for _, duplicate := range []models.User{
+			{Username: "alice", Email: "other@example.com", Password: "x"},
+			{Username: "other", Email: "alice@example.com", Password: "x"},
+		} {
+			if _, err := store.AddUser(duplicate); err == nil {
+				t.Errorf("AddUser(%s, %s) succeeded, want a duplicate error", duplicate.Username, duplicate.Email)
+			}
+		}
+
+		byID, err := store.GetUserByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		byName, err := store.GetUserByUsername("alice")
+		if err != nil {
+			t.Fatalf("GetUserByUsername: %v", err)
+		}
+		if byID.ID != user.ID || byName.ID != user.ID || byID.Email != "alice@example.com" {
+			t.Errorf("got users %+v and %+v, want alice with ID %d", byID, byName, user.ID)
+		}
+
+		// Only the password's hash is stored
+		if byID.Password == "secret" || bcrypt.CompareHashAndPassword([]byte(byID.Password), []byte("secret")) != nil {
+			t.Errorf("stored password %q is not the bcrypt hash of the password", byID.Password)
+		}
+
+		if _, err := store.GetUserByID(user.ID + 100); err == nil {
+			t.Error("GetUserByID of an unknown user succeeded")
+		}
+	})
+}
+
+func TestStoreProblemsAndTestCases(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		problem, testCases := addProblem(t, store, "A+B")
+
+		got, err := store.GetProblemByID(problem.ID)
+		if err != nil {
+			t.Fatalf("GetProblemByID: %v", err)
+		}
+		if got.Title != "A+B" || got.TimeLimit != 1000 {
+			t.Errorf("GetProblemByID = %+v, want the added problem", got)
+		}
+
+		problem.Title = "A+B again"
+		if _, err := store.UpdateProblem(problem); err != nil {
+			t.Fatalf("UpdateProblem: %v", err)
+		}
+		if got, _ := store.GetProblemByID(problem.ID); got.Title != "A+B again" {
+			t.Errorf("title after UpdateProblem = %q", got.Title)
+		}
+
+		updated := testCases[1]
+		updated.Output = "5\n"
+		if _, err := store.UpdateTestCase(updated); err != nil {
+			t.Fatalf("UpdateTestCase: %v", err)
+		}
+		if err := store.DeleteTestCase(problem.ID, testCases[0].ID); err != nil {
+			t.Fatalf("DeleteTestCase: %v", err)
+		}
+		if err := store.DeleteTestCase(problem.ID, testCases[0].ID); !errors.Is(err, ErrTestCaseNotFound) {
+			t.Errorf("deleting a deleted test case: %v, want ErrTestCaseNotFound", err)
+		}
+		if _, err := store.UpdateTestCase(testCases[0]); !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("updating a deleted test case: %v, want data.ErrNotFound", err)
+		}
+
+		remaining, err := store.GetTestCasesByProblemID(problem.ID)
+		if err != nil {
+			t.Fatalf("GetTestCasesByProblemID: %v", err)
+		}
+		if len(remaining) != 1 || remaining[0].ID != testCases[1].ID || remaining[0].Output != "5\n" {
+			t.Errorf("test cases = %+v, want the updated hidden one only", remaining)
+		}
+
+		if _, err := store.GetProblemByID(problem.ID + 100); !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("GetProblemByID of an unknown problem: %v, want data.ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreSubmissionsAndResults(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		user, err := store.AddUser(models.User{Username: "bob", Email: "bob@example.com", Password: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		problem, testCases := addProblem(t, store, "A+B")
+
+		if _, err := store.AddSubmission(models.Submission{UserID: user.ID + 100, ProblemID: problem.ID}); err == nil {
+			t.Error("AddSubmission by an unknown user succeeded")
+		}
+
+		finished := addSubmission(t, store, user.ID, problem.ID, "Testing")
+		waiting := addSubmission(t, store, user.ID, problem.ID, "Pending")
+
+		for _, tc := range testCases {
+			if _, err := store.AddTestResult(models.TestResult{SubmissionID: finished.ID, TestCaseID: tc.ID, Status: "Accepted"}); err != nil {
+				t.Fatalf("AddTestResult: %v", err)
+			}
+		}
+		if _, err := store.AddTestResult(models.TestResult{SubmissionID: finished.ID, TestCaseID: testCases[1].ID + 100}); err == nil {
+			t.Error("AddTestResult for an unknown test case succeeded")
+		}
+		finished.Status = "Accepted"
+		finished.Score = 100
+		if err := store.UpdateSubmission(finished); err != nil {
+			t.Fatalf("UpdateSubmission: %v", err)
+		}
+
+		got, err := store.GetSubmissionByID(finished.ID)
+		if err != nil {
+			t.Fatalf("GetSubmissionByID: %v", err)
+		}
+		if got.Status != "Accepted" || got.Score != 100 {
+			t.Errorf("GetSubmissionByID = %+v, want the updated submission", got)
+		}
+		results, err := store.GetTestResultsBySubmissionID(finished.ID)
+		if err != nil || len(results) != len(testCases) {
+			t.Errorf("GetTestResultsBySubmissionID = %+v, %v, want %d results", results, err, len(testCases))
+		}
+
+		judging, err := store.GetJudgingSubmissions()
+		if err != nil {
+			t.Fatalf("GetJudgingSubmissions: %v", err)
+		}
+		if len(judging) != 1 || judging[0].ID != waiting.ID {
+			t.Errorf("GetJudgingSubmissions = %+v, want submission %d only", judging, waiting.ID)
+		}
+
+		if err := store.DeleteTestResultsBySubmissionID(finished.ID); err != nil {
+			t.Fatalf("DeleteTestResultsBySubmissionID: %v", err)
+		}
+		if results, _ := store.GetTestResultsBySubmissionID(finished.ID); len(results) != 0 {
+			t.Errorf("results after DeleteTestResultsBySubmissionID = %+v", results)
+		}
+
+		if _, err := store.GetSubmissionByID(waiting.ID + 100); !errors.Is(err, ErrSubmissionNotFound) {
+			t.Errorf("GetSubmissionByID of an unknown submission: %v, want ErrSubmissionNotFound", err)
+		}
+	})
+}
+
+func TestStoreDeleteProblemWhileJudging(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		user, err := store.AddUser(models.User{Username: "carol", Email: "carol@example.com", Password: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		problem, _ := addProblem(t, store, "A+B")
+
+		for _, status := range []string{"Pending", "Testing"} {
+			submission := addSubmission(t, store, user.ID, problem.ID, status)
+			if err := store.DeleteProblem(problem.ID); !errors.Is(err, ErrProblemJudging) {
+				t.Fatalf("DeleteProblem with a %s submission: %v, want ErrProblemJudging", status, err)
+			}
+			if _, err := store.GetProblemByID(problem.ID); err != nil {
+				t.Fatalf("problem gone after a refused delete: %v", err)
+			}
+
+			submission.Status = "Wrong Answer"
+			if err := store.UpdateSubmission(submission); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := store.DeleteProblem(problem.ID); err != nil {
+			t.Fatalf("DeleteProblem: %v", err)
+		}
+		if _, err := store.GetProblemByID(problem.ID); !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("GetProblemByID after DeleteProblem: %v, want data.ErrNotFound", err)
+		}
+		if submissions := store.GetSubmissionsByProblemID(problem.ID); len(submissions) != 0 {
+			t.Errorf("submissions left after DeleteProblem: %+v", submissions)
+		}
+		if err := store.DeleteProblem(problem.ID); !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("deleting a deleted problem: %v, want data.ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreDoesNotReuseDeletedIDs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		user, err := store.AddUser(models.User{Username: "dave", Email: "dave@example.com", Password: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The deleted problem and submission have the highest IDs
+		problem, testCases := addProblem(t, store, "deleted")
+		submission := addSubmission(t, store, user.ID, problem.ID, "Accepted")
+		if err := store.DeleteProblem(problem.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		next, nextCases := addProblem(t, store, "next")
+		nextSubmission := addSubmission(t, store, user.ID, next.ID, "Accepted")
+		if next.ID <= problem.ID || nextCases[0].ID <= testCases[1].ID || nextSubmission.ID <= submission.ID {
+			t.Errorf("IDs after delete: problem %d, test case %d, submission %d; deleted %d, %d, %d",
+				next.ID, nextCases[0].ID, nextSubmission.ID, problem.ID, testCases[1].ID, submission.ID)
+		}
+	})
+}
+
+func TestStoreProblemRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		problem, testCases := addProblem(t, store, "A+B")
+
+		for i := 1; i <= 2; i++ {
+			revision, err := store.AddProblemRevision(models.ProblemRevision{
+				ProblemID: problem.ID, Action: models.RevisionUpdate, Problem: problem, TestCases: testCases,
+			})
+			if err != nil {
+				t.Fatalf("AddProblemRevision: %v", err)
+			}
+			if revision.Revision != i {
+				t.Errorf("revision number %d, want %d", revision.Revision, i)
+			}
+		}
+		if latest, err := store.GetLatestProblemRevision(problem.ID); err != nil || latest != 2 {
+			t.Errorf("GetLatestProblemRevision = %d, %v, want 2", latest, err)
+		}
+		if _, err := store.GetProblemRevision(problem.ID, 3); err == nil {
+			t.Error("GetProblemRevision of a missing revision succeeded")
+		}
+
+		// Restoring replaces the problem and its test cases together
+		restored := problem
+		restored.Title = "restored"
+		restoredCases := []models.TestCase{{ProblemID: problem.ID, Input: "5 5\n", Output: "10\n", IsExample: true}}
+		if _, _, err := store.RestoreProblem(restored, restoredCases); err != nil {
+			t.Fatalf("RestoreProblem: %v", err)
+		}
+		got, _ := store.GetProblemByID(problem.ID)
+		cases, _ := store.GetTestCasesByProblemID(problem.ID)
+		if got.Title != "restored" || len(cases) != 1 || cases[0].Input != "5 5\n" {
+			t.Errorf("after RestoreProblem: %+v with %+v", got, cases)
+		}
+	})
+}
+
+// TestSQLiteImportsMemoryStoreFiles opens a SQLite store where the memory
+// store saved its data files; the data is imported with its IDs
+func TestSQLiteImportsMemoryStoreFiles(t *testing.T) {
+	chdirTemp(t)
+
+	memory := NewMemoryStore()
+	user, err := memory.AddUser(models.User{Username: "erin", Email: "erin@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problem, testCases := addProblem(t, memory, "A+B")
+	submission := addSubmission(t, memory, user.ID, problem.ID, "Testing")
+	result, err := memory.AddTestResult(models.TestResult{SubmissionID: submission.ID, TestCaseID: testCases[0].ID, Status: "Accepted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submission.Status = "Accepted"
+	if err := memory.UpdateSubmission(submission); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.AddProblemRevision(models.ProblemRevision{ProblemID: problem.ID, Action: models.RevisionCreate, Problem: problem, TestCases: testCases}); err != nil {
+		t.Fatal(err)
+	}
+	storedUser, err := memory.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite := openSQLite(t)
+
+	if got, err := sqlite.GetUserByUsername("erin"); err != nil || got.ID != user.ID || got.Password != storedUser.Password {
+		t.Errorf("imported user = %+v, %v, want ID %d with the same password hash", got, err, user.ID)
+	}
+	if len(sqlite.ListProblems()) != len(memory.ListProblems()) {
+		t.Errorf("imported %d problems, want %d", len(sqlite.ListProblems()), len(memory.ListProblems()))
+	}
+	if got, err := sqlite.GetProblemByID(problem.ID); err != nil || got.Title != "A+B" {
+		t.Errorf("imported problem = %+v, %v", got, err)
+	}
+	if got, err := sqlite.GetTestCasesByProblemID(problem.ID); err != nil || len(got) != 2 || got[1].ID != testCases[1].ID || got[1].Output != "4\n" {
+		t.Errorf("imported test cases = %+v, %v, want %+v", got, err, testCases)
+	}
+	if got, err := sqlite.GetSubmissionByID(submission.ID); err != nil || got.Status != "Accepted" || got.UserID != user.ID {
+		t.Errorf("imported submission = %+v, %v", got, err)
+	}
+	if got, err := sqlite.GetTestResultsBySubmissionID(submission.ID); err != nil || len(got) != 1 || got[0].ID != result.ID {
+		t.Errorf("imported test results = %+v, %v, want result %d", got, err, result.ID)
+	}
+	if latest, err := sqlite.GetLatestProblemRevision(problem.ID); err != nil || latest != 1 {
+		t.Errorf("imported revisions: latest %d, %v, want 1", latest, err)
+	}
+
+	// New records continue after the imported IDs
+	next := addSubmission(t, sqlite, user.ID, problem.ID, "Pending")
+	if next.ID <= submission.ID {
+		t.Errorf("new submission ID %d, want above the imported %d", next.ID, submission.ID)
+	}
+}
@@ -0,0 +1,63 @@
+package judge
+
+import (
+	"log"
+
+	"github.com/user/cppjudge/internal/models"
+	"github.com/user/cppjudge/internal/sandbox"
+)
+
+// debugTimeFactor scales the time limit of debug runs, since instrumented
+// programs run several times slower
+const debugTimeFactor = 3
+
+// debugRun 在提交出现运行错误时，用 sanitizer 重新编译代码并运行样例，
+// 将第一份 sanitizer 报告附加到提交上。出错的测试用例是样例时优先运行它；
+// 非样例的测试数据不会被运行，以免泄露其内容。交互题的程序仍与交互程序对接运行
+func (j *Judge) debugRun(submission *models.Submission, language sandbox.Language, interactor *sandbox.Artifact, failed models.TestCase, testCases []models.TestCase, opts sandbox.RunOptions) {
+	if language.Interpreter != "" {
+		return
+	}
+
+	examples := make([]models.TestCase, 0, len(testCases))
+	if failed.IsExample {
+		examples = append(examples, failed)
+	}
+	for _, tc := range testCases {
+		if tc.IsExample && tc.ID != failed.ID {
+			examples = append(examples, tc)
+		}
+	}
+	if len(examples) == 0 {
+		return
+	}
+
+	artifact, err := j.sandbox.CompileDebug(language, compileFlags(*submission, language), submission.Code)
+	if err != nil {
+		log.Printf("调试编译提交 %d 失败: %v", submission.ID, err)
+		return
+	}
+	defer artifact.Cleanup()
+
+	opts.TimeLimit *= debugTimeFactor
+	for _, tc := range examples {
+		var result sandbox.ExecutionResult
+		if interactor != nil {
+			var interaction sandbox.InteractResult
+			interaction, err = j.sandbox.Interact(artifact, interactor, tc.Input, tc.Output, opts)
+			result = interaction.Program
+		} else {
+			result, err = j.sandbox.Run(artifact, tc.Input, opts)
+		}
+		if err != nil {
+			log.Printf("调试运行提交 %d 失败: %v", submission.ID, err)
+			return
+		}
+
+		if report := artifact.SanitizerReport(result.ErrorOutput); report != "" {
+			submission.DebugReport = report
+			submission.DebugTestCaseID = tc.ID
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package judge
+
+import (
+	"sync"
+
+	"github.com/user/cppjudge/internal/models"
+)
+
+// Event types published while a submission is judged
+const (
+	EventStatus     = "status"      // The submission's status changed
+	EventTestResult = "test_result" // A test case finished
+	EventDone       = "done"        // Judging finished; no more events follow
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped
+const subscriberBuffer = 64
+
+// Event is a progress update for one submission
+type Event struct {
+	Type         string
+	SubmissionID int
+	Status       string             // For EventStatus
+	TestResult   *models.TestResult // For EventTestResult
+	Submission   *models.Submission // For EventDone, the final submission
+}
+
+// Broker is an in-process publish/subscribe hub for judging events. It is
+// safe for concurrent use.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{} // by submission ID
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[int]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events of a submission and a
+// function that cancels the subscription. The channel is closed after
+// EventDone, on cancellation, or if the subscriber falls too far behind.
+func (b *Broker) Subscribe(submissionID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[submissionID] == nil {
+		b.subscribers[submissionID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[submissionID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(submissionID, ch)
+	}
+
+	return ch, cancel
+}
+
+// Publish delivers an event to all subscribers of its submission without
+// blocking. Subscribers whose buffer is full are dropped.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.SubmissionID] {
+		select {
+		case ch <- event:
+			if event.Type == EventDone {
+				b.remove(event.SubmissionID, ch)
+			}
+		default:
+			b.remove(event.SubmissionID, ch)
+		}
+	}
+}
+
+// remove closes and forgets a subscriber; b.mu must be held
+func (b *Broker) remove(submissionID int, ch chan Event) {
+	subs := b.subscribers[submissionID]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(b.subscribers, submissionID)
+	}
+}
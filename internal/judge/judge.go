@@ -1,8 +1,11 @@
 package judge
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/user/cppjudge/internal/db"
@@ -12,87 +15,200 @@ import (
 
 // Status constants
 const (
-	StatusPending           = "Pending"
-	StatusAccepted          = "Accepted"
-	StatusWrongAnswer       = "Wrong Answer"
-	StatusCompileError      = "Compilation Error"
-	StatusRuntimeError      = "Runtime Error"
-	StatusTimeLimitExceeded = "Time Limit Exceeded"
-	StatusInternalError     = "Internal Error"
+	StatusPending             = "Pending"
+	StatusTesting             = "Testing"
+	StatusAccepted            = "Accepted"
+	StatusWrongAnswer         = "Wrong Answer"
+	StatusPresentationError   = "Presentation Error"
+	StatusCompileError        = "Compilation Error"
+	StatusRuntimeError        = "Runtime Error"
+	StatusTimeLimitExceeded   = "Time Limit Exceeded"
+	StatusMemoryLimitExceeded = "Memory Limit Exceeded"
+	StatusOutputLimitExceeded = "Output Limit Exceeded"
+	StatusRestrictedFunction  = "Restricted Function"
+	StatusInternalError       = "Internal Error"
+	StatusJudgementFailed     = "Judgement Failed"
 )
 
-// Judge handles evaluating code submissions
+// storedOutputLimit caps the output kept in a test result, in bytes. Results
+// live as long as the server, so only a prefix is kept for display.
+const storedOutputLimit = 8 * 1024
+
+// Judge handles evaluating code submissions. It is safe to evaluate several
+// submissions concurrently.
 type Judge struct {
-	store   *db.MemoryStore
+	store   db.Store
 	sandbox *sandbox.CppSandbox
+	events  *Broker
+
+	// statusMu serializes read-modify-write updates of user problem statuses
+	statusMu sync.Mutex
+
+	// problemMu is held for writing while a problem is changed and its
+	// revision recorded, and for reading while a submission loads the
+	// problem it is judged against
+	problemMu sync.RWMutex
 }
 
 // NewJudge creates a new judge
-func NewJudge(store *db.MemoryStore, sandbox *sandbox.CppSandbox) *Judge {
+func NewJudge(store db.Store, sandbox *sandbox.CppSandbox) *Judge {
 	return &Judge{
 		store:   store,
 		sandbox: sandbox,
+		events:  NewBroker(),
+	}
+}
+
+// Events returns the broker that judging progress is published to
+func (j *Judge) Events() *Broker {
+	return j.events
+}
+
+// CompileCacheStats returns the statistics of the sandbox's compile cache
+func (j *Judge) CompileCacheStats() sandbox.CacheStats {
+	return j.sandbox.CacheStats()
+}
+
+// ChangeProblem runs change, which changes a problem and records its
+// revision, while no submission is loading problem data. Submissions thus
+// read a problem, its test cases and its latest revision number together.
+func (j *Judge) ChangeProblem(change func() error) error {
+	j.problemMu.Lock()
+	defer j.problemMu.Unlock()
+
+	return change()
+}
+
+// loadProblem 在同一状态下读取题目、测试用例与最新修订号，题目没有修订记录时修订号为0
+func (j *Judge) loadProblem(problemID int) (models.Problem, []models.TestCase, int, error) {
+	j.problemMu.RLock()
+	defer j.problemMu.RUnlock()
+
+	problem, err := j.store.GetProblemByID(problemID)
+	if err != nil {
+		return models.Problem{}, nil, 0, fmt.Errorf("获取问题信息失败: %w", err)
+	}
+	testCases, err := j.store.GetTestCasesByProblemID(problemID)
+	if err != nil {
+		return models.Problem{}, nil, 0, fmt.Errorf("获取测试用例失败: %w", err)
 	}
+	revision, err := j.store.GetLatestProblemRevision(problemID)
+	if err != nil {
+		return models.Problem{}, nil, 0, fmt.Errorf("获取题目修订号失败: %w", err)
+	}
+
+	return problem, testCases, revision, nil
 }
 
 // EvaluateSubmission 评估一个提交
-func (j *Judge) EvaluateSubmission(submissionID int) error {
+func (j *Judge) EvaluateSubmission(submissionID int) (err error) {
+	// 评测结束（包括出错）时通知订阅者
+	defer func() {
+		j.finish(submissionID, err)
+	}()
+
 	// 获取提交信息
 	submission, err := j.store.GetSubmissionByID(submissionID)
 	if err != nil {
 		return fmt.Errorf("获取提交信息失败: %w", err)
 	}
 
-	// 获取问题信息
-	problem, err := j.store.GetProblemByID(submission.ProblemID)
+	// 获取问题信息、测试用例与评测所依据的题目修订
+	problem, testCases, revision, err := j.loadProblem(submission.ProblemID)
 	if err != nil {
-		return fmt.Errorf("获取问题信息失败: %w", err)
-	}
-
-	// 获取测试用例
-	testCases, err := j.store.GetTestCasesByProblemID(problem.ID)
-	if err != nil {
-		return fmt.Errorf("获取测试用例失败: %w", err)
+		return err
 	}
 
 	if len(testCases) == 0 {
 		return fmt.Errorf("问题没有测试用例")
 	}
+	submission.ProblemRevision = revision
 
 	// 将状态更新为"测试中"
-	submission.Status = "Testing"
+	submission.Status = StatusTesting
 	if err := j.store.UpdateSubmission(submission); err != nil {
 		return fmt.Errorf("更新提交状态失败: %w", err)
 	}
+	j.events.Publish(Event{Type: EventStatus, SubmissionID: submission.ID, Status: submission.Status})
 
-	// 获取当前用户的解题状态，初始化用户提交计数
-	userStatus, err := j.store.GetUserProblemStatus(submission.UserID, submission.ProblemID)
-	if err != nil && err.Error() != "user not found" && err.Error() != "problem not found" {
-		return fmt.Errorf("获取用户解题状态失败: %w", err)
+	language, ok := sandbox.LookupLanguage(submission.Language)
+	if !ok {
+		return fmt.Errorf("不支持的语言: %s", submission.Language)
 	}
 
-	// 标记为用户已尝试
-	userStatus.UserID = submission.UserID
-	userStatus.ProblemID = submission.ProblemID
-	userStatus.Attempted = true
-	userStatus.LastAttemptAt = time.Now()
+	// 本次运行的限制，按值传递，不修改共享的沙箱配置
+	opts := j.sandbox.DefaultOptions()
+	opts.TimeLimit = language.TimeLimit(problem.TimeLimit)
+	opts.MemoryLimit = problem.MemoryLimit
+	setIOFiles(&opts, problem)
 
 	// 执行测试
 	allPassed := true
+	firstFailure := ""
+	var failedTestCase models.TestCase
 	maxTime := 0
 	maxMemory := 0
+	statuses := make(map[int]string, len(testCases))
+
+	// 编译一次，所有测试用例复用同一个可执行文件
+	artifact, err := j.sandbox.CompileLanguage(language, compileFlags(submission, language), submission.Code)
+	var compileErr *sandbox.CompileError
+	if err != nil && !errors.As(err, &compileErr) {
+		return fmt.Errorf("编译提交失败: %w", err)
+	}
+	if artifact != nil {
+		defer artifact.Cleanup()
+	}
+	if compileErr != nil {
+		submission.CompileOutput = compileErr.Output
+	}
+
+	// 题目配置了特判程序或交互程序时同样只编译一次
+	var checker, interactor *sandbox.Artifact
+	if compileErr == nil {
+		checker, err = j.compileProblemProgram(&submission, problem.ID, problem.Checker, "特判程序")
+		if err != nil {
+			return err
+		}
+		if checker != nil {
+			defer checker.Cleanup()
+		}
+
+		interactor, err = j.compileProblemProgram(&submission, problem.ID, problem.Interactor, "交互程序")
+		if err != nil {
+			return err
+		}
+		if interactor != nil {
+			defer interactor.Cleanup()
+		}
+	}
 
 	for _, tc := range testCases {
-		// 运行测试用例
-		result := j.evaluateTestCase(submission, tc, problem.TimeLimit)
+		// 运行测试用例，编译失败时所有测试用例均为编译错误
+		var result models.TestResult
+		if compileErr != nil {
+			result = models.TestResult{
+				SubmissionID: submission.ID,
+				TestCaseID:   tc.ID,
+				Status:       StatusCompileError,
+			}
+		} else {
+			result = j.evaluateTestCase(submission, problem, artifact, checker, interactor, tc, opts)
+		}
 
 		// 保存测试结果
 		savedResult, err := j.store.AddTestResult(result)
 		if err != nil {
 			log.Printf("保存测试结果失败: %v", err)
 			allPassed = false
+			if firstFailure == "" {
+				firstFailure = StatusInternalError
+			}
+			statuses[tc.ID] = StatusInternalError
 			continue
 		}
+		statuses[tc.ID] = savedResult.Status
+		j.events.Publish(Event{Type: EventTestResult, SubmissionID: submission.ID, TestResult: &savedResult})
 
 		// 更新最大运行时间和内存使用
 		if savedResult.RunTime > maxTime {
@@ -102,83 +218,283 @@ func (j *Judge) EvaluateSubmission(submissionID int) error {
 			maxMemory = savedResult.Memory
 		}
 
-		// 如果有测试用例失败，整体结果就是失败
-		if savedResult.Status != "Accepted" {
+		// 如果有测试用例失败，整体结果为第一个失败的测试用例的状态
+		if savedResult.Status != StatusAccepted {
 			allPassed = false
+			if firstFailure == "" {
+				firstFailure = savedResult.Status
+				failedTestCase = tc
+			}
 		}
 	}
 
+	// 按需用 sanitizer 找出运行错误的原因
+	if submission.Debug && firstFailure == StatusRuntimeError {
+		j.debugRun(&submission, language, interactor, failedTestCase, testCases, opts)
+	}
+
 	// 更新提交状态
 	submission.RunTime = maxTime
 	submission.Memory = maxMemory
+	submission.Score, submission.SubtaskResults = scoreSubmission(problem, testCases, statuses)
 	if allPassed {
-		submission.Status = "Accepted"
+		submission.Status = StatusAccepted
+	} else {
+		submission.Status = firstFailure
+	}
+
+	// 更新用户解题状态
+	j.updateUserProblemStatus(submission, allPassed)
+
+	// 保存最终提交结果
+	if err := j.store.UpdateSubmission(submission); err != nil {
+		return fmt.Errorf("更新提交状态失败: %w", err)
+	}
+
+	return nil
+}
+
+// compileProblemProgram 编译题目的特判程序或交互程序，code 为空时返回 nil。
+// 编译失败时将提交标记为评测失败
+func (j *Judge) compileProblemProgram(submission *models.Submission, problemID int, code, name string) (*sandbox.Artifact, error) {
+	if code == "" {
+		return nil, nil
+	}
+
+	artifact, err := j.sandbox.Compile(code)
+	if err != nil {
+		var compileErr *sandbox.CompileError
+		if errors.As(err, &compileErr) {
+			log.Printf("题目 %d 的%s编译失败:\n%s", problemID, name, compileErr.Output)
+		}
+		submission.Status = StatusJudgementFailed
+		if updateErr := j.store.UpdateSubmission(*submission); updateErr != nil {
+			log.Printf("更新提交状态失败: %v", updateErr)
+		}
+		return nil, fmt.Errorf("编译%s失败: %w", name, err)
+	}
+
+	return artifact, nil
+}
 
+// finish 在评测结束时发布最终结果。评测出错且提交仍未完成时，将其标记为内部错误，
+// 避免提交一直停留在评测中
+func (j *Judge) finish(submissionID int, evalErr error) {
+	submission, err := j.store.GetSubmissionByID(submissionID)
+	if err != nil {
+		return
+	}
+
+	if evalErr != nil && (submission.Status == StatusPending || submission.Status == StatusTesting) {
+		submission.Status = StatusInternalError
+		if err := j.store.UpdateSubmission(submission); err != nil {
+			log.Printf("更新提交状态失败: %v", err)
+		}
+		// 重测前的结果已计入解题状态，需要撤销
+		if submission.RejudgedFrom != "" {
+			j.updateRejudgedStatus(submission)
+		}
+	}
+
+	j.events.Publish(Event{Type: EventDone, SubmissionID: submissionID, Submission: &submission})
+}
+
+// updateUserProblemStatus 根据评测结果更新用户解题状态，重测的提交改为重新计算
+func (j *Judge) updateUserProblemStatus(submission models.Submission, passed bool) {
+	if submission.RejudgedFrom != "" {
+		j.updateRejudgedStatus(submission)
+		return
+	}
+
+	j.statusMu.Lock()
+	defer j.statusMu.Unlock()
+
+	// 获取当前用户的解题状态
+	userStatus, err := j.store.GetUserProblemStatus(submission.UserID, submission.ProblemID)
+	if err != nil && err.Error() != "user not found" && err.Error() != "problem not found" {
+		log.Printf("获取用户解题状态失败: %v", err)
+		return
+	}
+
+	// 标记为用户已尝试
+	userStatus.UserID = submission.UserID
+	userStatus.ProblemID = submission.ProblemID
+	userStatus.Attempted = true
+	userStatus.LastAttemptAt = time.Now()
+	if submission.Score > userStatus.BestScore {
+		userStatus.BestScore = submission.Score
+	}
+
+	if passed {
 		// 更新用户解题状态为已解决
 		userStatus.Solved = true
 		if userStatus.FirstSolvedAt.IsZero() {
 			userStatus.FirstSolvedAt = time.Now()
 		}
 	} else {
-		submission.Status = "Failed"
-
 		// 增加失败次数
 		userStatus.FailedAttempts++
 	}
 
 	// 保存用户解题状态
-	_, err = j.store.UpdateUserProblemStatus(userStatus)
-	if err != nil {
+	if _, err := j.store.UpdateUserProblemStatus(userStatus); err != nil {
 		log.Printf("更新用户解题状态失败: %v", err)
 	}
+}
 
-	// 保存最终提交结果
-	if err := j.store.UpdateSubmission(submission); err != nil {
-		return fmt.Errorf("更新提交状态失败: %w", err)
+// setIOFiles makes runs read and write the problem's files if it uses file I/O
+func setIOFiles(opts *sandbox.RunOptions, problem models.Problem) {
+	if problem.IOMode == models.IOModeFile {
+		opts.InputFile = problem.IOFileName + ".in"
+		opts.OutputFile = problem.IOFileName + ".out"
 	}
+}
 
-	return nil
+// compileFlags returns the compiler flags recorded on a submission. Older
+// submissions without a compiler profile use the language's default profile.
+func compileFlags(submission models.Submission, language sandbox.Language) []string {
+	if submission.CompilerProfile != "" {
+		return submission.CompileFlags
+	}
+	profile, _ := sandbox.LookupCompilerProfile(language.DefaultProfile)
+	return profile.Flags
 }
 
-// evaluateTestCase evaluates a submission against a single test case
-func (j *Judge) evaluateTestCase(submission models.Submission, testCase models.TestCase, timeLimit int) models.TestResult {
+// evaluateTestCase runs the compiled submission against a single test case.
+// If interactor is not nil, the submission talks to it and it decides the
+// verdict. Otherwise, if checker is not nil, it decides whether the output is
+// correct, and without either the output is compared using the problem's
+// comparison mode.
+func (j *Judge) evaluateTestCase(submission models.Submission, problem models.Problem, artifact, checker, interactor *sandbox.Artifact, testCase models.TestCase, opts sandbox.RunOptions) models.TestResult {
 	result := models.TestResult{
 		SubmissionID: submission.ID,
 		TestCaseID:   testCase.ID,
 	}
 
-	// Set the sandbox time limit to match the problem time limit (with some buffer)
-	j.sandbox.TimeLimit = timeLimit
-
-	// Execute the code
-	execResult, err := j.sandbox.Execute(submission.Code, testCase.Input)
+	// Run the compiled code, against the interactor for interactive problems
+	var execResult sandbox.ExecutionResult
+	var interaction sandbox.InteractResult
+	var err error
+	if interactor != nil {
+		interaction, err = j.sandbox.Interact(artifact, interactor, testCase.Input, testCase.Output, opts)
+		execResult = interaction.Program
+	} else {
+		execResult, err = j.sandbox.Run(artifact, testCase.Input, opts)
+	}
 	if err != nil {
 		result.Status = StatusInternalError
 		return result
 	}
 
-	// Store the execution result
-	result.Output = execResult.Output
+	// Store the execution result; the whole output is only needed for judging
+	result.Output = truncateOutput(execResult.Output, storedOutputLimit)
 	result.RunTime = execResult.RunTime
+	result.WallTime = execResult.WallTime
+	result.Memory = execResult.Memory
+	result.Signal = execResult.Signal
 
 	// Determine the status based on execution result
-	switch execResult.Status {
-	case "Compilation Error":
-		result.Status = StatusCompileError
-	case "Runtime Error":
-		result.Status = StatusRuntimeError
-	case "Time Limit Exceeded":
-		result.Status = StatusTimeLimitExceeded
-	case "Success":
+	verdict, done := executionStatus(execResult.Status)
+	switch {
+	case done:
+		result.Status = verdict
+	case interactor != nil:
+		result.Status = StatusAccepted
+	case checker != nil:
+		result.Status, result.Message = j.check(checker, testCase, execResult.Output)
+	default:
 		// Compare output with expected output
-		if sandbox.CompareOutput(testCase.Output, execResult.Output) {
+		compareOpts := sandbox.CompareOptions{Mode: problem.CompareMode, Epsilon: problem.Epsilon}
+		if sandbox.Compare(testCase.Output, execResult.Output, compareOpts) {
 			result.Status = StatusAccepted
 		} else {
 			result.Status = StatusWrongAnswer
 		}
-	default:
-		result.Status = StatusInternalError
+	}
+
+	if interactor != nil {
+		result.Status, result.Message = interactionStatus(result.Status, interaction)
+		if result.Status == StatusJudgementFailed {
+			log.Printf("交互程序评测失败 (测试用例 %d): %s", testCase.ID, result.Message)
+		}
 	}
 
 	return result
 }
+
+// executionStatus maps the status the sandbox gives a run to its verdict. done
+// is false for a run that ended normally, whose output is still to be judged.
+// A status the sandbox does not define is an internal error.
+func executionStatus(status string) (verdict string, done bool) {
+	switch status {
+	case "Success":
+		return "", false
+	case "Runtime Error":
+		return StatusRuntimeError, true
+	case "Time Limit Exceeded":
+		return StatusTimeLimitExceeded, true
+	case "Memory Limit Exceeded":
+		return StatusMemoryLimitExceeded, true
+	case "Output Limit Exceeded":
+		return StatusOutputLimitExceeded, true
+	case "Restricted Function":
+		return StatusRestrictedFunction, true
+	default:
+		return StatusInternalError, true
+	}
+}
+
+// truncateOutput shortens output to at most limit bytes without splitting a character
+func truncateOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	return strings.ToValidUTF8(output[:limit], "")
+}
+
+// check runs the problem's checker on a program's output
+func (j *Judge) check(checker *sandbox.Artifact, testCase models.TestCase, output string) (string, string) {
+	checkResult, err := j.sandbox.Check(checker, testCase.Input, output, testCase.Output)
+	if err != nil {
+		log.Printf("运行特判程序失败: %v", err)
+		return StatusInternalError, ""
+	}
+
+	switch checkResult.Verdict {
+	case sandbox.CheckerAccepted:
+		return StatusAccepted, checkResult.Message
+	case sandbox.CheckerWrongAnswer:
+		return StatusWrongAnswer, checkResult.Message
+	case sandbox.CheckerPresentationError:
+		return StatusPresentationError, checkResult.Message
+	default:
+		log.Printf("特判程序评测失败 (测试用例 %d): %s", testCase.ID, checkResult.Message)
+		return StatusJudgementFailed, checkResult.Message
+	}
+}
+
+// interactionStatus combines the status of a program's run with the verdict
+// of the interactor it talked to. Limits the program broke come first. A wrong
+// answer outranks a runtime error, as programs often fail once the interactor
+// has quit, while a program that crashed is to blame for an interactor that
+// ran out of input or wrote to a closed pipe.
+func interactionStatus(programStatus string, interaction sandbox.InteractResult) (string, string) {
+	switch programStatus {
+	case StatusTimeLimitExceeded, StatusMemoryLimitExceeded, StatusOutputLimitExceeded,
+		StatusRestrictedFunction, StatusInternalError:
+		return programStatus, ""
+	}
+
+	switch {
+	case interaction.Verdict == sandbox.CheckerWrongAnswer:
+		return StatusWrongAnswer, interaction.Message
+	case programStatus == StatusRuntimeError:
+		return StatusRuntimeError, interaction.Message
+	case interaction.Verdict == sandbox.CheckerPresentationError:
+		return StatusPresentationError, interaction.Message
+	case interaction.Verdict == sandbox.CheckerAccepted:
+		return StatusAccepted, interaction.Message
+	default:
+		return StatusJudgementFailed, interaction.Message
+	}
+}
@@ -0,0 +1,323 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/cppjudge/internal/db"
+	"github.com/user/cppjudge/internal/models"
+	"github.com/user/cppjudge/internal/sandbox"
+)
+
+// isolationProgram burns CPU time between writing its ID to a file in its
+// working directory and reading it back. A directory shared with another run
+// shows up as a file already present at the start or changed by the end.
+const isolationProgram = `#include <cstdio>
+int main() {
+	int id;
+	if (scanf("%d", &id) != 1) return 1;
+	if (FILE *f = fopen("marker", "r")) {
+		fclose(f);
+		puts("shared directory");
+		return 0;
+	}
+	FILE *f = fopen("marker", "w");
+	if (!f) return 2;
+	fprintf(f, "%d", id);
+	fclose(f);
+
+	volatile unsigned long long sum = 0;
+	for (unsigned long long i = 0; i < 300000000ULL; i++) sum += i;
+
+	int got = -1;
+	f = fopen("marker", "r");
+	if (!f || fscanf(f, "%d", &got) != 1) return 3;
+	fclose(f);
+	printf("%d\n", got);
+	return 0;
+}
+`
+
+// sumProgram prints the sum of two numbers
+const sumProgram = `#include <cstdio>
+int main() { int a, b; scanf("%d%d", &a, &b); printf("%d\n", a + b); }
+`
+
+// newTestJudge creates a judge whose store keeps its data files in a
+// temporary working directory
+func newTestJudge(t *testing.T) (*Judge, db.Store, *sandbox.CppSandbox) {
+	t.Helper()
+	if _, err := exec.LookPath("g++"); err != nil {
+		t.Skip("g++ not found")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// The test checks limits and run directories, not isolation, so it also
+	// runs where namespaces cannot be created
+	t.Setenv("SANDBOX_ALLOW_UNISOLATED", "1")
+	sb, err := sandbox.NewCppSandbox()
+	if err != nil {
+		t.Fatalf("NewCppSandbox: %v", err)
+	}
+	t.Cleanup(func() { sb.Cleanup() })
+
+	store := db.NewMemoryStore()
+	return NewJudge(store, sb), store, sb
+}
+
+// waitJudged waits until each submission's events report it judged
+func waitJudged(t *testing.T, events map[int]<-chan Event) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Minute)
+	for id, ch := range events {
+	wait:
+		for {
+			select {
+			case event := <-ch:
+				if event.Type == EventDone {
+					break wait
+				}
+			case <-timeout:
+				t.Fatalf("submission %d was not judged in time", id)
+			}
+		}
+	}
+}
+
+// TestParallelSubmissionsKeepTheirLimits judges submissions with different
+// time limits at the same time. Each must be judged against its own problem's
+// limit and run in a working directory of its own.
+func TestParallelSubmissionsKeepTheirLimits(t *testing.T) {
+	j, store, sb := newTestJudge(t)
+
+	user, err := store.AddUser(models.User{Username: "parallel", Email: "parallel@example.com", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The program needs far more than the tight limit and far less than the
+	// loose one
+	limits := []int{50, 10000, 50, 10000, 50, 10000}
+	want := make(map[int]string, len(limits))
+	events := make(map[int]<-chan Event, len(limits))
+	for i, limit := range limits {
+		problem, err := store.AddProblem(models.Problem{
+			Title:       fmt.Sprintf("limit %d", limit),
+			Description: "parallel judging",
+			TimeLimit:   limit,
+			MemoryLimit: 65536,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := fmt.Sprint(i + 1)
+		if _, err := store.AddTestCase(models.TestCase{ProblemID: problem.ID, Input: id + "\n", Output: id + "\n"}); err != nil {
+			t.Fatal(err)
+		}
+
+		submission, err := store.AddSubmission(models.Submission{
+			UserID:    user.ID,
+			ProblemID: problem.ID,
+			Code:      isolationProgram,
+			Language:  "cpp17",
+			Status:    StatusPending,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[submission.ID] = StatusAccepted
+		if limit < 1000 {
+			want[submission.ID] = StatusTimeLimitExceeded
+		}
+
+		ch, cancel := j.Events().Subscribe(submission.ID)
+		t.Cleanup(cancel)
+		events[submission.ID] = ch
+	}
+
+	queue := NewQueue(j, len(limits), len(limits))
+	t.Cleanup(func() { queue.Shutdown(context.Background()) })
+	for id := range want {
+		if _, err := queue.Enqueue(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitJudged(t, events)
+
+	for id, status := range want {
+		submission, err := store.GetSubmissionByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if submission.Status != status {
+			results, _ := store.GetTestResultsBySubmissionID(id)
+			t.Errorf("submission %d on problem %d: status %q, want %q (results %+v)",
+				id, submission.ProblemID, submission.Status, status, results)
+		}
+	}
+
+	// Every run directory is removed once its run ends
+	entries, err := os.ReadDir(sb.TempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "run-") {
+			t.Errorf("run directory %s left behind", entry.Name())
+		}
+	}
+}
+
+// TestRecoverAfterRestart judges the submissions a stopped server left
+// waiting or being judged once a new one starts on the same data
+func TestRecoverAfterRestart(t *testing.T) {
+	_, store, sb := newTestJudge(t)
+
+	user, err := store.AddUser(models.User{Username: "restart", Email: "restart@example.com", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problem, err := store.AddProblem(models.Problem{Title: "A+B", Description: "restart", TimeLimit: 1000, MemoryLimit: 65536})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCase, err := store.AddTestCase(models.TestCase{ProblemID: problem.ID, Input: "1 2\n", Output: "3\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, status := range []string{StatusPending, StatusTesting, StatusTesting} {
+		submission, err := store.AddSubmission(models.Submission{
+			UserID: user.ID, ProblemID: problem.ID, Code: sumProgram, Language: "cpp17", Status: status,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, submission.ID)
+	}
+	// The submission being judged had a result saved before the stop, along
+	// with the results of another one that finished
+	if _, err := store.AddTestResult(models.TestResult{SubmissionID: ids[1], TestCaseID: testCase.ID, Status: StatusWrongAnswer}); err != nil {
+		t.Fatal(err)
+	}
+	finished, err := store.GetSubmissionByID(ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished.Status = StatusAccepted
+	if err := store.UpdateSubmission(finished); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new server loads the same data files
+	restarted := db.NewMemoryStore()
+	j := NewJudge(restarted, sb)
+	events := make(map[int]<-chan Event)
+	for _, id := range ids[:2] {
+		ch, cancel := j.Events().Subscribe(id)
+		t.Cleanup(cancel)
+		events[id] = ch
+	}
+
+	queue := NewQueue(j, 2, 10)
+	t.Cleanup(func() { queue.Shutdown(context.Background()) })
+	queued, err := queue.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued != 2 {
+		t.Fatalf("Recover queued %d submissions, want 2", queued)
+	}
+	waitJudged(t, events)
+
+	for _, id := range ids {
+		submission, err := restarted.GetSubmissionByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := restarted.GetTestResultsBySubmissionID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if submission.Status != StatusAccepted {
+			t.Errorf("submission %d: status %q, want %q", id, submission.Status, StatusAccepted)
+		}
+		if id != ids[2] && (len(results) != 1 || results[0].Status != StatusAccepted) {
+			t.Errorf("submission %d: results %+v, want one accepted result", id, results)
+		}
+	}
+
+	// Nothing is left being judged
+	if err := restarted.DeleteProblem(problem.ID); err != nil {
+		t.Errorf("DeleteProblem: %v", err)
+	}
+}
+
+// TestShutdownJudgesWaitingSubmissions shuts the queue down while submissions
+// are still waiting; they are all judged before Shutdown returns
+func TestShutdownJudgesWaitingSubmissions(t *testing.T) {
+	j, store, _ := newTestJudge(t)
+
+	user, err := store.AddUser(models.User{Username: "shutdown", Email: "shutdown@example.com", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problem, err := store.AddProblem(models.Problem{Title: "A+B", Description: "shutdown", TimeLimit: 1000, MemoryLimit: 65536})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddTestCase(models.TestCase{ProblemID: problem.ID, Input: "1 2\n", Output: "3\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := NewQueue(j, 1, 10)
+	var ids []int
+	for i := 0; i < 4; i++ {
+		submission, err := store.AddSubmission(models.Submission{
+			UserID: user.ID, ProblemID: problem.ID, Code: sumProgram, Language: "cpp17", Status: StatusPending,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := queue.Enqueue(submission.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, submission.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := queue.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := queue.Enqueue(ids[0]); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Enqueue after Shutdown: %v, want ErrQueueClosed", err)
+	}
+
+	for _, id := range ids {
+		submission, err := store.GetSubmissionByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if submission.Status != StatusAccepted {
+			t.Errorf("submission %d: status %q, want %q", id, submission.Status, StatusAccepted)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/user/cppjudge/internal/data"
+)
+
+// Queue errors
+var (
+	ErrQueueFull   = errors.New("judge queue is full")
+	ErrQueueClosed = errors.New("judge queue is shut down")
+)
+
+// Queue is a bounded FIFO of submissions waiting to be evaluated by a fixed
+// pool of workers, so that at most `workers` programs are compiled and run at
+// the same time.
+type Queue struct {
+	judge    *Judge
+	capacity int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []int // submission IDs in arrival order
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewQueue creates a queue holding at most capacity waiting submissions and
+// starts the given number of workers
+func NewQueue(judge *Judge, workers, capacity int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &Queue{
+		judge:    judge,
+		capacity: capacity,
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+
+	log.Printf("判题队列已启动: %d 个工作协程, 容量 %d", workers, capacity)
+	return q
+}
+
+// Enqueue adds a submission to the end of the queue and returns its 1-based
+// position
+func (q *Queue) Enqueue(submissionID int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	if q.capacity > 0 && len(q.pending) >= q.capacity {
+		return 0, ErrQueueFull
+	}
+
+	q.pending = append(q.pending, submissionID)
+	q.cond.Signal()
+
+	return len(q.pending), nil
+}
+
+// Rejudge clears the results of finished submissions and queues them for
+// evaluation again, in the given order. Submissions still waiting or being
+// judged, and those that cannot be reset, are skipped; the IDs of the queued
+// ones are returned. If they would not all fit in the queue, nothing is
+// changed and ErrQueueFull is returned.
+func (q *Queue) Rejudge(submissionIDs []int) ([]int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	if q.capacity > 0 && len(q.pending)+len(submissionIDs) > q.capacity {
+		return nil, ErrQueueFull
+	}
+
+	// Resetting under q.mu keeps a submission from being queued twice
+	queued := make([]int, 0, len(submissionIDs))
+	for _, id := range submissionIDs {
+		if err := q.judge.prepareRejudge(id); err != nil {
+			if !errors.Is(err, ErrSubmissionJudging) {
+				log.Printf("重测提交 %d 失败: %v", id, err)
+			}
+			continue
+		}
+		q.pending = append(q.pending, id)
+		queued = append(queued, id)
+	}
+	q.cond.Broadcast()
+
+	return queued, nil
+}
+
+// Recover queues the submissions left waiting or being judged when the server
+// last stopped, oldest first. Those cut short while being judged have their
+// results cleared and are judged again from the start; a rejudge keeps the
+// verdict it replaces. They were accepted before, so the queue's capacity
+// does not apply. It returns the number of submissions queued.
+func (q *Queue) Recover() (int, error) {
+	submissions, err := q.judge.store.GetJudgingSubmissions()
+	if err != nil {
+		return 0, fmt.Errorf("获取未完成评测的提交失败: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	queued := 0
+	for _, submission := range submissions {
+		if err := q.judge.resetSubmission(submission); err != nil {
+			log.Printf("重新排队提交 %d 失败: %v", submission.ID, err)
+			continue
+		}
+		q.pending = append(q.pending, submission.ID)
+		queued++
+	}
+	q.cond.Broadcast()
+
+	if queued > 0 {
+		log.Printf("重新排队 %d 个上次关闭时未完成评测的提交", queued)
+	}
+	return queued, nil
+}
+
+// Position returns the 1-based position of a waiting submission, or 0 if the
+// submission is not waiting (already being judged, finished or unknown)
+func (q *Queue) Position(submissionID int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, id := range q.pending {
+		if id == submissionID {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// Len returns the number of waiting submissions
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// Shutdown stops accepting submissions and waits for the workers to judge
+// every submission still waiting and finish those being judged. If ctx is done
+// first, the workers take no more submissions and ctx.Err() is returned; the
+// ones still waiting stay pending, to be queued by Recover on the next start.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	if waiting := len(q.pending); waiting > 0 {
+		log.Printf("判题队列关闭，等待评测剩余的 %d 个提交", waiting)
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if waiting := len(q.pending); waiting > 0 {
+			log.Printf("判题队列关闭超时，%d 个提交将在下次启动时重新排队", waiting)
+		}
+		q.pending = nil
+		q.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// worker evaluates submissions from the head of the queue until it is shut
+// down and empty
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		submissionID := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		err := q.judge.EvaluateSubmission(submissionID)
+		switch {
+		case errors.Is(err, data.ErrNotFound):
+			// 排队期间提交或题目已被删除
+			log.Printf("提交 %d 或其题目已不存在，跳过评测", submissionID)
+		case err != nil:
+			log.Printf("评测提交 %d 失败: %v", submissionID, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package judge
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/user/cppjudge/internal/models"
+)
+
+// ErrSubmissionJudging is returned when rejudging a submission that is still
+// waiting or being judged
+var ErrSubmissionJudging = errors.New("submission is still being judged")
+
+// prepareRejudge 清除已完成提交的测试结果并将其重置为等待评测，
+// 原评测结果记录在 RejudgedFrom 中。编译配置与编译选项保持不变
+func (j *Judge) prepareRejudge(submissionID int) error {
+	submission, err := j.store.GetSubmissionByID(submissionID)
+	if err != nil {
+		return fmt.Errorf("获取提交信息失败: %w", err)
+	}
+	if submission.Status == StatusPending || submission.Status == StatusTesting {
+		return ErrSubmissionJudging
+	}
+
+	submission.RejudgedFrom = submission.Status
+	return j.resetSubmission(submission)
+}
+
+// resetSubmission 清除提交的测试结果与评测结果，并将其重置为等待评测
+func (j *Judge) resetSubmission(submission models.Submission) error {
+	if err := j.store.DeleteTestResultsBySubmissionID(submission.ID); err != nil {
+		return fmt.Errorf("清除测试结果失败: %w", err)
+	}
+
+	submission.Status = StatusPending
+	submission.RunTime = 0
+	submission.Memory = 0
+	submission.Score = 0
+	submission.SubtaskResults = nil
+	submission.CompileOutput = ""
+	submission.DebugReport = ""
+	submission.DebugTestCaseID = 0
+	if err := j.store.UpdateSubmission(submission); err != nil {
+		return fmt.Errorf("更新提交状态失败: %w", err)
+	}
+	j.events.Publish(Event{Type: EventStatus, SubmissionID: submission.ID, Status: submission.Status})
+
+	return nil
+}
+
+// countsAsAttempt reports whether a verdict was counted in the user's problem
+// status. Evaluations that ended in an internal error never were.
+func countsAsAttempt(status string) bool {
+	switch status {
+	case "", StatusPending, StatusTesting, StatusInternalError:
+		return false
+	}
+	return true
+}
+
+// updateRejudgedStatus 在重测结束后重新计算用户解题状态。失败次数按重测前后结果的差异调整；
+// 是否解决、首次解决时间与最高得分根据该用户对该题的提交重新计算。
+// 提交开始持久化之前的解题状态可能由已不存在的提交产生，因此早于现有提交的首次解决记录会被保留
+func (j *Judge) updateRejudgedStatus(submission models.Submission) {
+	j.statusMu.Lock()
+	defer j.statusMu.Unlock()
+
+	userStatus, err := j.store.GetUserProblemStatus(submission.UserID, submission.ProblemID)
+	if err != nil {
+		log.Printf("获取用户解题状态失败: %v", err)
+		return
+	}
+
+	if countsAsAttempt(submission.RejudgedFrom) && submission.RejudgedFrom != StatusAccepted {
+		userStatus.FailedAttempts--
+	}
+	if countsAsAttempt(submission.Status) && submission.Status != StatusAccepted {
+		userStatus.FailedAttempts++
+	}
+	if userStatus.FailedAttempts < 0 {
+		userStatus.FailedAttempts = 0
+	}
+
+	// 重测的提交可能尚未保存最终结果
+	var submissions []models.Submission
+	for _, s := range j.store.GetSubmissionsByProblemID(submission.ProblemID) {
+		if s.ID == submission.ID {
+			s = submission
+		}
+		if s.UserID == submission.UserID {
+			submissions = append(submissions, s)
+		}
+	}
+
+	// 首次解决早于现有的所有提交时，说明是重启前的提交解决的
+	keepSolved := userStatus.Solved && len(submissions) > 0 &&
+		userStatus.FirstSolvedAt.Before(submissions[0].SubmittedAt)
+	if !keepSolved {
+		userStatus.Solved = false
+		userStatus.FirstSolvedAt = time.Time{}
+		userStatus.BestScore = 0
+	}
+	for _, s := range submissions {
+		if s.Score > userStatus.BestScore {
+			userStatus.BestScore = s.Score
+		}
+		if s.Status == StatusAccepted && !userStatus.Solved {
+			userStatus.Solved = true
+			userStatus.FirstSolvedAt = s.SubmittedAt
+		}
+	}
+	userStatus.UserID = submission.UserID
+	userStatus.ProblemID = submission.ProblemID
+	userStatus.Attempted = true
+
+	if _, err := j.store.UpdateUserProblemStatus(userStatus); err != nil {
+		log.Printf("更新用户解题状态失败: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package judge
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/user/cppjudge/internal/models"
+	"github.com/user/cppjudge/internal/sandbox"
+)
+
+// RunResult is the outcome of running code on custom input
+type RunResult struct {
+	Status        string `json:"status"`
+	Stdout        string `json:"stdout"` // Standard output, or the output file for problems with file I/O
+	Stderr        string `json:"stderr"`
+	ExitCode      int    `json:"exit_code"`
+	RunTime       int    `json:"run_time"`  // CPU time in milliseconds
+	WallTime      int    `json:"wall_time"` // Elapsed real time in milliseconds
+	Memory        int    `json:"memory"`
+	Signal        string `json:"signal,omitempty"`
+	CompileOutput string `json:"compile_output,omitempty"`
+	Message       string `json:"message,omitempty"` // Interactor feedback for interactive problems
+}
+
+// Run compiles code with the given compiler flags and runs it once on the
+// given input under the problem's limits. For interactive problems the input
+// is given to the interactor, with an empty answer, and the program talks to
+// it; Stdout is then empty. Nothing is stored: no submission is created and
+// the user's problem status is left untouched.
+func (j *Judge) Run(problem models.Problem, language sandbox.Language, flags []string, code, input string) (RunResult, error) {
+	result := RunResult{}
+
+	artifact, err := j.sandbox.CompileLanguage(language, flags, code)
+	if err != nil {
+		var compileErr *sandbox.CompileError
+		if errors.As(err, &compileErr) {
+			result.Status = StatusCompileError
+			result.CompileOutput = compileErr.Output
+			return result, nil
+		}
+		return result, fmt.Errorf("编译代码失败: %w", err)
+	}
+	defer artifact.Cleanup()
+
+	opts := j.sandbox.DefaultOptions()
+	opts.TimeLimit = language.TimeLimit(problem.TimeLimit)
+	opts.MemoryLimit = problem.MemoryLimit
+	setIOFiles(&opts, problem)
+
+	var execResult sandbox.ExecutionResult
+	var interaction sandbox.InteractResult
+	if problem.Interactor != "" {
+		var interactor *sandbox.Artifact
+		interactor, err = j.sandbox.Compile(problem.Interactor)
+		if err != nil {
+			return result, fmt.Errorf("编译交互程序失败: %w", err)
+		}
+		defer interactor.Cleanup()
+
+		interaction, err = j.sandbox.Interact(artifact, interactor, input, "", opts)
+		execResult = interaction.Program
+	} else {
+		execResult, err = j.sandbox.Run(artifact, input, opts)
+	}
+	if err != nil {
+		return result, fmt.Errorf("运行代码失败: %w", err)
+	}
+
+	result.Stdout = execResult.Output
+	result.Stderr = execResult.ErrorOutput
+	result.ExitCode = execResult.ExitCode
+	result.RunTime = execResult.RunTime
+	result.WallTime = execResult.WallTime
+	result.Memory = execResult.Memory
+	result.Signal = execResult.Signal
+
+	// A run that ended normally keeps the sandbox's "Success"; its output is
+	// not judged
+	status, done := executionStatus(execResult.Status)
+	if !done {
+		status = execResult.Status
+	}
+	result.Status = status
+	if problem.Interactor != "" {
+		result.Status, result.Message = interactionStatus(result.Status, interaction)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package judge
+
+import (
+	"sort"
+
+	"github.com/user/cppjudge/internal/models"
+)
+
+// fullScore is the score of a fully accepted problem without subtasks
+const fullScore = 100
+
+// scoreSubmission computes the OI-style score of a submission from the status
+// of each test case, keyed by test case ID. Without subtasks every test case
+// is worth the same share of fullScore; with subtasks only test cases that
+// belong to a subtask count towards the score.
+func scoreSubmission(problem models.Problem, testCases []models.TestCase, statuses map[int]string) (int, []models.SubtaskResult) {
+	if len(problem.Subtasks) == 0 {
+		if len(testCases) == 0 {
+			return 0, nil
+		}
+		passed := 0
+		for _, tc := range testCases {
+			if statuses[tc.ID] == StatusAccepted {
+				passed++
+			}
+		}
+		return fullScore * passed / len(testCases), nil
+	}
+
+	// Dependencies always refer to subtasks with smaller IDs
+	subtasks := append([]models.Subtask(nil), problem.Subtasks...)
+	sort.Slice(subtasks, func(i, j int) bool {
+		return subtasks[i].ID < subtasks[j].ID
+	})
+
+	total := 0
+	fullyPassed := make(map[int]bool, len(subtasks))
+	results := make([]models.SubtaskResult, 0, len(subtasks))
+
+	for _, st := range subtasks {
+		result := models.SubtaskResult{
+			Subtask:  st.ID,
+			Status:   StatusAccepted,
+			MaxScore: st.Score,
+		}
+
+		count, passed := 0, 0
+		for _, tc := range testCases {
+			if tc.Subtask != st.ID {
+				continue
+			}
+			count++
+			status, ok := statuses[tc.ID]
+			if !ok {
+				status = StatusInternalError
+			}
+			if status == StatusAccepted {
+				passed++
+			} else if result.Status == StatusAccepted {
+				// 子任务的状态取第一个未通过的测试用例
+				result.Status = status
+			}
+		}
+
+		// 没有测试用例的子任务属于题目配置错误，不给分
+		if count == 0 {
+			result.Status = StatusJudgementFailed
+		}
+
+		dependenciesPassed := true
+		for _, dep := range st.DependsOn {
+			if !fullyPassed[dep] {
+				dependenciesPassed = false
+				break
+			}
+		}
+
+		if count > 0 && dependenciesPassed {
+			switch st.Scoring {
+			case models.SubtaskScoringSum:
+				result.Score = st.Score * passed / count
+			default:
+				if passed == count {
+					result.Score = st.Score
+				}
+			}
+		}
+
+		fullyPassed[st.ID] = count > 0 && passed == count && dependenciesPassed
+		total += result.Score
+		results = append(results, result)
+	}
+
+	return total, results
+}
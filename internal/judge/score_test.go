@@ -0,0 +1,156 @@
+package judge
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/cppjudge/internal/models"
+)
+
+// subtaskCases returns test cases with IDs from 1, one per subtask number
+func subtaskCases(subtasks ...int) []models.TestCase {
+	testCases := make([]models.TestCase, len(subtasks))
+	for i, subtask := range subtasks {
+		testCases[i] = models.TestCase{ID: i + 1, Subtask: subtask}
+	}
+	return testCases
+}
+
+func TestScoreSubmission(t *testing.T) {
+	const (
+		ac = StatusAccepted
+		wa = StatusWrongAnswer
+	)
+
+	tests := []struct {
+		name        string
+		subtasks    []models.Subtask
+		testCases   []models.TestCase
+		statuses    map[int]string
+		wantScore   int
+		wantResults []models.SubtaskResult
+	}{
+		{
+			name:      "no subtasks, share of passed test cases",
+			testCases: subtaskCases(0, 0, 0, 0),
+			statuses:  map[int]string{1: ac, 2: wa, 3: ac, 4: ac},
+			wantScore: 75,
+		},
+		{
+			name:      "no subtasks, no test cases",
+			wantScore: 0,
+		},
+		{
+			name: "partial min and sum subtasks",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 40, Scoring: models.SubtaskScoringMin},
+				{ID: 2, Score: 60, Scoring: models.SubtaskScoringSum},
+			},
+			testCases: subtaskCases(1, 1, 2, 2, 2),
+			statuses:  map[int]string{1: ac, 2: wa, 3: ac, 4: StatusTimeLimitExceeded, 5: ac},
+			wantScore: 40,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: wa, Score: 0, MaxScore: 40},
+				{Subtask: 2, Status: StatusTimeLimitExceeded, Score: 40, MaxScore: 60},
+			},
+		},
+		{
+			name: "empty scoring is min, test cases outside subtasks do not count",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 50},
+				{ID: 2, Score: 50},
+			},
+			testCases: subtaskCases(0, 1, 2, 2),
+			statuses:  map[int]string{1: wa, 2: ac, 3: ac, 4: wa},
+			wantScore: 50,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: ac, Score: 50, MaxScore: 50},
+				{Subtask: 2, Status: wa, Score: 0, MaxScore: 50},
+			},
+		},
+		{
+			name: "dependencies passed",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 30},
+				{ID: 2, Score: 70, Scoring: models.SubtaskScoringSum, DependsOn: []int{1}},
+			},
+			testCases: subtaskCases(1, 2, 2),
+			statuses:  map[int]string{1: ac, 2: ac, 3: wa},
+			wantScore: 65,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: ac, Score: 30, MaxScore: 30},
+				{Subtask: 2, Status: wa, Score: 35, MaxScore: 70},
+			},
+		},
+		{
+			name: "failed dependency scores nothing, even when passed",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 20},
+				{ID: 2, Score: 30, DependsOn: []int{1}},
+				{ID: 3, Score: 50, Scoring: models.SubtaskScoringSum, DependsOn: []int{2}},
+			},
+			testCases: subtaskCases(1, 2, 3, 3),
+			statuses:  map[int]string{1: wa, 2: ac, 3: ac, 4: ac},
+			wantScore: 0,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: wa, Score: 0, MaxScore: 20},
+				{Subtask: 2, Status: ac, Score: 0, MaxScore: 30},
+				{Subtask: 3, Status: ac, Score: 0, MaxScore: 50},
+			},
+		},
+		{
+			name: "partial sum dependency is not fully passed",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 40, Scoring: models.SubtaskScoringSum},
+				{ID: 2, Score: 60, DependsOn: []int{1}},
+			},
+			testCases: subtaskCases(1, 1, 2),
+			statuses:  map[int]string{1: ac, 2: wa, 3: ac},
+			wantScore: 20,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: wa, Score: 20, MaxScore: 40},
+				{Subtask: 2, Status: ac, Score: 0, MaxScore: 60},
+			},
+		},
+		{
+			name: "subtasks scored in ID order",
+			subtasks: []models.Subtask{
+				{ID: 2, Score: 60, DependsOn: []int{1}},
+				{ID: 1, Score: 40},
+			},
+			testCases: subtaskCases(1, 2),
+			statuses:  map[int]string{1: ac, 2: ac},
+			wantScore: 100,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: ac, Score: 40, MaxScore: 40},
+				{Subtask: 2, Status: ac, Score: 60, MaxScore: 60},
+			},
+		},
+		{
+			name: "missing status and empty subtask",
+			subtasks: []models.Subtask{
+				{ID: 1, Score: 50, Scoring: models.SubtaskScoringSum},
+				{ID: 2, Score: 50},
+			},
+			testCases: subtaskCases(1, 1),
+			statuses:  map[int]string{1: ac},
+			wantScore: 25,
+			wantResults: []models.SubtaskResult{
+				{Subtask: 1, Status: StatusInternalError, Score: 25, MaxScore: 50},
+				{Subtask: 2, Status: StatusJudgementFailed, Score: 0, MaxScore: 50},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, results := scoreSubmission(models.Problem{Subtasks: tt.subtasks}, tt.testCases, tt.statuses)
+			if score != tt.wantScore {
+				t.Errorf("score = %d, want %d", score, tt.wantScore)
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("results = %+v, want %+v", results, tt.wantResults)
+			}
+		})
+	}
+}
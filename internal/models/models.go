@@ -19,48 +19,149 @@ type Problem struct {
 	ID                int       `json:"id"`
 	Title             string    `json:"title"`
 	Description       string    `json:"description"`
-	Difficulty        string    `json:"difficulty"`         // Easy, Medium, Hard
-	TimeLimit         int       `json:"time_limit"`         // In milliseconds
-	MemoryLimit       int       `json:"memory_limit"`       // In kilobytes
-	KnowledgeTag      []string  `json:"knowledge_tag"`      // 知识点标签，例如：["数组", "二分搜索", "动态规划"]
-	ReferenceSolution string    `json:"reference_solution"` // 参考解答代码
-	ThinkingAnalysis  string    `json:"thinking_analysis"`  // 思维训练分析
+	Difficulty        string    `json:"difficulty"`                  // Easy, Medium, Hard
+	TimeLimit         int       `json:"time_limit"`                  // In milliseconds
+	MemoryLimit       int       `json:"memory_limit"`                // In kilobytes
+	KnowledgeTag      []string  `json:"knowledge_tag"`               // 知识点标签，例如：["数组", "二分搜索", "动态规划"]
+	ReferenceSolution string    `json:"reference_solution"`          // 参考解答代码
+	ThinkingAnalysis  string    `json:"thinking_analysis"`           // 思维训练分析
+	Checker           string    `json:"checker,omitempty"`           // 特判程序（testlib兼容的C++源码），为空时按文本比较输出
+	Interactor        string    `json:"interactor,omitempty"`        // 交互程序（testlib兼容的C++源码），不为空时为交互题
+	CompareMode       string    `json:"compare_mode,omitempty"`      // 输出比较方式: exact, tokens, case_insensitive, numeric，为空时为exact
+	Epsilon           float64   `json:"epsilon,omitempty"`           // numeric比较方式允许的绝对或相对误差，为0时使用1e-6
+	Subtasks          []Subtask `json:"subtasks,omitempty"`          // 子任务，为空时按通过的测试用例比例计分
+	CompilerProfiles  []string  `json:"compiler_profiles,omitempty"` // 允许使用的编译配置，为空时不限制
+	IOMode            string    `json:"io_mode,omitempty"`           // 输入输出方式: stdio, file，为空时为stdio
+	IOFileName        string    `json:"io_file_name,omitempty"`      // file方式的文件名（不含扩展名），程序读取<name>.in并写入<name>.out
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// Problem difficulties
+const (
+	DifficultyEasy   = "Easy"
+	DifficultyMedium = "Medium"
+	DifficultyHard   = "Hard"
+)
+
+// Problem I/O modes
+const (
+	IOModeStdio = "stdio" // 从标准输入读取，向标准输出写入
+	IOModeFile  = "file"  // 读写IOFileName对应的文件，如NOIP/CSP题目
+)
+
+// Subtask scoring modes
+const (
+	SubtaskScoringMin = "min" // 子任务内所有测试用例通过才得分
+	SubtaskScoringSum = "sum" // 按子任务内通过的测试用例比例得分
+)
+
+// Subtask groups test cases of a problem for OI-style scoring
+type Subtask struct {
+	ID        int    `json:"id"`                   // 子任务编号，从1开始
+	Score     int    `json:"score"`                // 子任务分值
+	Scoring   string `json:"scoring"`              // 计分方式: min 或 sum，为空时为min
+	DependsOn []int  `json:"depends_on,omitempty"` // 依赖的子任务编号，依赖未得满分时本子任务不得分
+}
+
+// SubtaskResult is the outcome of a submission on one subtask
+type SubtaskResult struct {
+	Subtask  int    `json:"subtask"`
+	Status   string `json:"status"` // Accepted if all its test cases passed, otherwise the first failing status
+	Score    int    `json:"score"`
+	MaxScore int    `json:"max_score"`
+}
+
 // TestCase represents input/output test data for a problem
 type TestCase struct {
 	ID        int    `json:"id"`
 	ProblemID int    `json:"problem_id"`
 	Input     string `json:"input"`
 	Output    string `json:"output"`
-	IsExample bool   `json:"is_example"` // Whether this test case is shown to users
+	IsExample bool   `json:"is_example"`        // Whether this test case is shown to users
+	Subtask   int    `json:"subtask,omitempty"` // 所属子任务编号，0表示不属于任何子任务
 }
 
 // Submission represents a user's code submission
 type Submission struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	ProblemID   int       `json:"problem_id"`
-	Language    string    `json:"language"` // Currently only C++
-	Code        string    `json:"code"`
-	Status      string    `json:"status"`   // Pending, Accepted, Wrong Answer, Time Limit Exceeded, etc.
-	RunTime     int       `json:"run_time"` // In milliseconds
-	Memory      int       `json:"memory"`   // In kilobytes
-	CreatedAt   time.Time `json:"created_at"`
-	SubmittedAt time.Time `json:"submitted_at"`
+	ID              int             `json:"id"`
+	UserID          int             `json:"user_id"`
+	ProblemID       int             `json:"problem_id"`
+	Language        string          `json:"language"`                   // Language ID, such as cpp17 or python3
+	CompilerProfile string          `json:"compiler_profile,omitempty"` // 使用的编译配置
+	CompileFlags    []string        `json:"compile_flags,omitempty"`    // 提交时编译配置的编译选项，重测时保持不变
+	Code            string          `json:"code"`
+	Status          string          `json:"status"`                       // Pending, Testing, Accepted or the first failing verdict (Wrong Answer, Time Limit Exceeded, etc.)
+	RunTime         int             `json:"run_time"`                     // Longest CPU time of a test, in milliseconds
+	Memory          int             `json:"memory"`                       // In kilobytes
+	Score           int             `json:"score"`                        // 得分，无子任务时满分为100，否则为各子任务分值之和
+	SubtaskResults  []SubtaskResult `json:"subtask_results,omitempty"`    // 各子任务的得分情况
+	CompileOutput   string          `json:"compile_output,omitempty"`     // 编译错误时的编译器输出
+	Debug           bool            `json:"debug,omitempty"`              // 运行错误时用 sanitizer 重新编译并运行样例
+	DebugReport     string          `json:"debug_report,omitempty"`       // 调试运行的 sanitizer 报告
+	DebugTestCaseID int             `json:"debug_test_case_id,omitempty"` // 产生调试报告的样例
+	RejudgedFrom    string          `json:"rejudged_from,omitempty"`      // 最近一次重测前的评测结果，未重测过时为空
+	ProblemRevision int             `json:"problem_revision,omitempty"`   // 评测时题目的修订号，0表示题目当时没有修订记录
+	CreatedAt       time.Time       `json:"created_at"`
+	SubmittedAt     time.Time       `json:"submitted_at"`
+}
+
+// Problem revision actions
+const (
+	RevisionCreate         = "create"            // 创建题目，包括导入与保存生成的题目
+	RevisionBaseline       = "baseline"          // 修订记录出现之前已有的题目，在第一次修改前记录
+	RevisionUpdate         = "update"            // 修改题目
+	RevisionAddTestCase    = "add_test_case"     // 添加测试用例
+	RevisionUpdateTestCase = "update_test_case"  // 修改测试用例
+	RevisionDeleteTestCase = "delete_test_case"  // 删除测试用例
+	RevisionReload         = "reload_test_cases" // 从数据文件重新读取测试用例
+	RevisionRollback       = "rollback"          // 回滚到之前的修订
+)
+
+// ProblemRevision is an immutable snapshot of a problem and its test cases,
+// recorded after each change
+type ProblemRevision struct {
+	ID           int              `json:"id"`
+	ProblemID    int              `json:"problem_id"`
+	Revision     int              `json:"revision"`                // 题目内的修订号，从1开始
+	Action       string           `json:"action"`                  // 产生该修订的操作
+	AuthorID     int              `json:"author_id,omitempty"`     // 修改者的用户ID，0表示未知
+	RestoredFrom int              `json:"restored_from,omitempty"` // 回滚时恢复的修订号
+	Problem      Problem          `json:"problem"`
+	TestCases    []TestCase       `json:"test_cases"`
+	Changes      []RevisionChange `json:"changes"` // 相对上一修订的变化，第一个修订为空
+	CreatedAt    time.Time        `json:"created_at"`
 }
 
+// RevisionChange is a difference between two revisions of a problem: a
+// changed problem field, or an added, removed or changed test case field
+type RevisionChange struct {
+	TestCaseID int         `json:"test_case_id,omitempty"` // 为0时是题目字段的变化
+	Field      string      `json:"field,omitempty"`        // JSON字段名，测试用例增删时为空
+	Change     string      `json:"change"`                 // added, removed 或 modified
+	Old        interface{} `json:"old,omitempty"`
+	New        interface{} `json:"new,omitempty"`
+}
+
+// Revision change kinds
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
 // TestResult represents the result of a submission on a specific test case
 type TestResult struct {
 	ID           int    `json:"id"`
 	SubmissionID int    `json:"submission_id"`
 	TestCaseID   int    `json:"test_case_id"`
-	Status       string `json:"status"`   // Accepted, Wrong Answer, Time Limit Exceeded, etc.
-	Output       string `json:"output"`   // The actual output produced by the submission
-	RunTime      int    `json:"run_time"` // In milliseconds
-	Memory       int    `json:"memory"`   // In kilobytes
+	Status       string `json:"status"`            // Accepted, Wrong Answer, Time Limit Exceeded, etc.
+	Output       string `json:"output"`            // The actual output produced by the submission
+	RunTime      int    `json:"run_time"`          // CPU time in milliseconds
+	WallTime     int    `json:"wall_time"`         // Elapsed real time in milliseconds
+	Memory       int    `json:"memory"`            // In kilobytes
+	Signal       string `json:"signal,omitempty"`  // Signal that terminated the program, such as SIGSEGV
+	Message      string `json:"message,omitempty"` // Feedback from the problem's checker
 }
 
 // UserProblemStatus 表示用户对特定问题的解题状态
@@ -71,6 +172,7 @@ type UserProblemStatus struct {
 	Attempted      bool      `json:"attempted"`       // 用户是否尝试过该题目
 	Solved         bool      `json:"solved"`          // 用户是否解决了该题目
 	FailedAttempts int       `json:"failed_attempts"` // 失败尝试次数
+	BestScore      int       `json:"best_score"`      // 历次提交的最高得分
 	LastAttemptAt  time.Time `json:"last_attempt_at"` // 最后一次尝试的时间
 	FirstSolvedAt  time.Time `json:"first_solved_at"` // 首次解决的时间
 	CreatedAt      time.Time `json:"created_at"`
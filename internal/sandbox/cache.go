@@ -0,0 +1,209 @@
+package sandbox
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStats describes the compile cache
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Size      int64  `json:"size"`  // Bytes on disk
+	Limit     int64  `json:"limit"` // Bytes, 0 means caching is off
+}
+
+// artifactCache keeps successful builds in directories named after a hash of
+// their source, compiler and flags, so that identical code is compiled only
+// once. Entries in use are never removed; the least recently used idle ones
+// are evicted once the cache outgrows its limit.
+type artifactCache struct {
+	dir   string
+	limit int64 // In bytes
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	lru     *list.List // Of *cacheEntry, most recently used first
+	size    int64
+	stats   CacheStats
+}
+
+// cacheEntry is a build in the cache. ready is closed once the build is done;
+// a failed build is removed from the cache before that.
+type cacheEntry struct {
+	key      string
+	artifact Artifact
+	size     int64
+	refs     int
+	ready    chan struct{}
+	failed   bool
+	elem     *list.Element
+}
+
+func newArtifactCache(dir string, limit int64) *artifactCache {
+	return &artifactCache{
+		dir:     dir,
+		limit:   limit,
+		entries: make(map[string]*cacheEntry),
+		lru:     list.New(),
+	}
+}
+
+// cacheKey hashes everything that determines a build's result
+func cacheKey(language Language, flags []string, code string) string {
+	h := sha256.New()
+	write := func(s string) {
+		// Length prefixes keep ("ab", "c") and ("a", "bc") apart
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+	write(language.ID)
+	write(language.SourceFile)
+	write(language.Compiler)
+	write(language.Interpreter)
+	for _, args := range [][]string{language.CompileArgs, language.RunArgs, flags} {
+		write(fmt.Sprint(len(args)))
+		for _, arg := range args {
+			write(arg)
+		}
+	}
+	write(code)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns a copy of the cached artifact for key, building it with build
+// in a fresh directory on a miss. Concurrent calls for the same key share a
+// single build. The caller must Cleanup the artifact to release the entry.
+func (c *artifactCache) get(key string, build func(dir string) (*Artifact, error)) (*Artifact, error) {
+	c.mu.Lock()
+	for {
+		entry, ok := c.entries[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		<-entry.ready
+		c.mu.Lock()
+		if entry.failed {
+			// The build failed, so repeat it to report its error
+			continue
+		}
+		c.stats.Hits++
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		c.mu.Unlock()
+		return c.artifactOf(entry), nil
+	}
+
+	entry := &cacheEntry{key: key, refs: 1, ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	dir := filepath.Join(c.dir, key)
+	artifact, err := c.build(dir, build)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(entry.ready)
+	if err != nil {
+		entry.failed = true
+		delete(c.entries, key)
+		return nil, err
+	}
+
+	entry.artifact = *artifact
+	entry.size = dirSize(dir)
+	entry.elem = c.lru.PushFront(entry)
+	c.size += entry.size
+	c.evict()
+
+	return c.artifactOf(entry), nil
+}
+
+// build runs build in dir, which is created empty and removed if it fails
+func (c *artifactCache) build(dir string, build func(dir string) (*Artifact, error)) (*Artifact, error) {
+	os.RemoveAll(dir)
+	if err := os.Mkdir(dir, 0711); err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %w", err)
+	}
+	// Mkdir is subject to the umask
+	if err := os.Chmod(dir, 0711); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to set build directory permissions: %w", err)
+	}
+
+	artifact, err := build(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// artifactOf returns a copy of an entry's artifact whose Cleanup releases it.
+// The entry must be built and already counted in refs.
+func (c *artifactCache) artifactOf(entry *cacheEntry) *Artifact {
+	artifact := entry.artifact
+	var once sync.Once
+	artifact.release = func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			entry.refs--
+			c.evict()
+		})
+	}
+	return &artifact
+}
+
+// evict removes the least recently used idle entries until the cache fits
+// its limit. c.mu must be held.
+func (c *artifactCache) evict() {
+	for elem := c.lru.Back(); elem != nil && c.size > c.limit; {
+		entry := elem.Value.(*cacheEntry)
+		prev := elem.Prev()
+		if entry.refs == 0 {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.key)
+			c.size -= entry.size
+			c.stats.Evictions++
+			os.RemoveAll(entry.artifact.dir)
+		}
+		elem = prev
+	}
+}
+
+// snapshot returns the cache's current statistics
+func (c *artifactCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Size = c.size
+	stats.Limit = c.limit
+	return stats
+}
+
+// dirSize returns the total size of the regular files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
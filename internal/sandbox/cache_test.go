@@ -0,0 +1,175 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCache is an artifact cache whose builds write a file of a given size
+type testCache struct {
+	*artifactCache
+	t      *testing.T
+	builds map[string]int // Builds by key
+}
+
+func newTestCache(t *testing.T, limit int64) *testCache {
+	return &testCache{
+		artifactCache: newArtifactCache(t.TempDir(), limit),
+		t:             t,
+		builds:        make(map[string]int),
+	}
+}
+
+// get returns the artifact for key, built with size bytes on a miss
+func (c *testCache) get(key string, size int) *Artifact {
+	c.t.Helper()
+
+	artifact, err := c.artifactCache.get(key, func(dir string) (*Artifact, error) {
+		c.builds[key]++
+		executable := filepath.Join(dir, "program")
+		if err := os.WriteFile(executable, make([]byte, size), 0755); err != nil {
+			return nil, err
+		}
+		return &Artifact{dir: dir, Executable: executable}, nil
+	})
+	if err != nil {
+		c.t.Fatalf("get(%s): %v", key, err)
+	}
+	return artifact
+}
+
+// use gets the artifact for key and releases it at once
+func (c *testCache) use(key string, size int) {
+	c.t.Helper()
+	c.get(key, size).Cleanup()
+}
+
+// checkCached checks which keys are in the cache and which builds are left on
+// disk
+func (c *testCache) checkCached(cached []string, evicted []string) {
+	c.t.Helper()
+
+	for _, key := range cached {
+		if _, ok := c.entries[key]; !ok {
+			c.t.Errorf("%s is not cached", key)
+		}
+		if _, err := os.Stat(filepath.Join(c.dir, key)); err != nil {
+			c.t.Errorf("build of cached %s: %v", key, err)
+		}
+	}
+	for _, key := range evicted {
+		if _, ok := c.entries[key]; ok {
+			c.t.Errorf("%s is still cached", key)
+		}
+		if _, err := os.Stat(filepath.Join(c.dir, key)); !os.IsNotExist(err) {
+			c.t.Errorf("build of evicted %s left on disk: %v", key, err)
+		}
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTestCache(t, 350)
+
+	c.use("a", 100)
+	c.use("b", 100)
+	c.use("c", 100)
+	// a becomes the most recently used, leaving b the least
+	c.use("a", 100)
+
+	c.use("d", 100)
+	c.checkCached([]string{"a", "c", "d"}, []string{"b"})
+
+	c.use("c", 100)
+	c.use("e", 100)
+	c.checkCached([]string{"c", "d", "e"}, []string{"a", "b"})
+
+	// A hit is not built again; an evicted build is
+	c.use("c", 100)
+	c.use("b", 100)
+	if c.builds["c"] != 1 || c.builds["b"] != 2 {
+		t.Errorf("builds = %v, want c built once and b twice", c.builds)
+	}
+	c.checkCached([]string{"b", "c", "e"}, []string{"a", "d"})
+
+	stats := c.snapshot()
+	want := CacheStats{Hits: 3, Misses: 6, Evictions: 3, Entries: 3, Size: 300, Limit: 350}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestCacheByteLimit(t *testing.T) {
+	c := newTestCache(t, 250)
+
+	// Small builds fill the cache up to its limit
+	c.use("small1", 50)
+	c.use("small2", 50)
+	c.use("medium", 150)
+	if stats := c.snapshot(); stats.Size != 250 || stats.Evictions != 0 {
+		t.Errorf("stats at the limit = %+v, want 250 bytes and no evictions", stats)
+	}
+
+	// One large build takes the room of several small ones
+	c.use("large", 200)
+	c.checkCached([]string{"large"}, []string{"small1", "small2", "medium"})
+	if stats := c.snapshot(); stats.Size != 200 || stats.Evictions != 3 {
+		t.Errorf("stats after the large build = %+v, want 200 bytes and 3 evictions", stats)
+	}
+
+	// A build larger than the whole cache is not kept once released
+	huge := c.get("huge", 300)
+	c.checkCached([]string{"huge"}, []string{"large"})
+	huge.Cleanup()
+	c.checkCached(nil, []string{"huge"})
+	if stats := c.snapshot(); stats.Size != 0 || stats.Entries != 0 {
+		t.Errorf("stats after the huge build = %+v, want an empty cache", stats)
+	}
+}
+
+func TestCacheKeepsEntriesInUse(t *testing.T) {
+	c := newTestCache(t, 150)
+
+	a := c.get("a", 100)
+	b := c.get("b", 100)
+	// Both are in use, so the cache stays over its limit
+	c.checkCached([]string{"a", "b"}, nil)
+	if stats := c.snapshot(); stats.Size != 200 {
+		t.Errorf("size with both in use = %d, want 200", stats.Size)
+	}
+
+	// The least recently used entry goes once released, even if the other
+	// was released first
+	a2 := c.get("a", 100)
+	b.Cleanup()
+	c.checkCached([]string{"a"}, []string{"b"})
+
+	a.Cleanup()
+	a.Cleanup() // A second Cleanup does not release the entry again
+	c.checkCached([]string{"a"}, nil)
+	if _, err := os.Stat(a2.Executable); err != nil {
+		t.Errorf("artifact in use: %v", err)
+	}
+	a2.Cleanup()
+	c.checkCached([]string{"a"}, nil)
+}
+
+func TestCacheDoesNotKeepFailedBuilds(t *testing.T) {
+	c := newTestCache(t, 1000)
+
+	errBuild := errors.New("build failed")
+	for i := 0; i < 2; i++ {
+		_, err := c.artifactCache.get("broken", func(dir string) (*Artifact, error) {
+			c.builds["broken"]++
+			return nil, errBuild
+		})
+		if !errors.Is(err, errBuild) {
+			t.Fatalf("get: %v, want the build error", err)
+		}
+	}
+	if c.builds["broken"] != 2 {
+		t.Errorf("failed build ran %d times, want 2", c.builds["broken"])
+	}
+	c.checkCached(nil, []string{"broken"})
+}
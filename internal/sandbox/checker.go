@@ -0,0 +1,107 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Checker verdicts
+const (
+	CheckerAccepted          = "Accepted"
+	CheckerWrongAnswer       = "Wrong Answer"
+	CheckerPresentationError = "Presentation Error"
+	CheckerFailed            = "Judgement Failed"
+)
+
+// Files a checker is given, in testlib's argv order: input, output, answer
+const (
+	checkerInputFile  = "input.txt"
+	checkerOutputFile = "output.txt"
+	checkerAnswerFile = "answer.txt"
+)
+
+const (
+	checkerTimeLimit     = 10000 // In milliseconds
+	checkerMessageLength = 1024  // In bytes
+)
+
+// testlib exit codes
+const (
+	testlibOK                = 0
+	testlibWrongAnswer       = 1
+	testlibPresentationError = 2
+	testlibFail              = 3
+	testlibDirt              = 4
+	testlibPoints            = 7
+	testlibUnexpectedEOF     = 8
+	testlibPartially         = 16
+)
+
+// CheckResult is the outcome of running a checker on a program's output
+type CheckResult struct {
+	Verdict string
+	Message string // Checker feedback, as written to stderr by testlib
+}
+
+// Check runs a compiled special judge on a program's output. The checker is
+// invoked like a testlib checker, `checker input.txt output.txt answer.txt`,
+// and its exit code decides the verdict. A checker that crashes, times out or
+// reports _fail yields CheckerFailed.
+func (s *CppSandbox) Check(checker *Artifact, input, output, answer string) (CheckResult, error) {
+	opts := s.DefaultOptions()
+	opts.TimeLimit = checkerTimeLimit
+
+	files := map[string]string{
+		checkerInputFile:  input,
+		checkerOutputFile: output,
+		checkerAnswerFile: answer,
+	}
+	args := []string{checkerInputFile, checkerOutputFile, checkerAnswerFile}
+
+	execResult, err := s.run(checker, args, files, "", nil, opts)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	return testlibVerdict("checker", execResult), nil
+}
+
+// testlibVerdict derives a verdict from the run of a testlib checker or
+// interactor, named by role in messages about its failures
+func testlibVerdict(role string, execResult ExecutionResult) CheckResult {
+	result := CheckResult{Message: checkerMessage(execResult.ErrorOutput)}
+
+	switch execResult.Status {
+	case "Success", "Runtime Error":
+	default:
+		result.Verdict = CheckerFailed
+		result.Message = fmt.Sprintf("%s: %s", role, execResult.Status)
+		return result
+	}
+
+	switch code := execResult.ExitCode; {
+	case code == testlibOK:
+		result.Verdict = CheckerAccepted
+	case code == testlibWrongAnswer, code == testlibDirt, code == testlibPoints, code >= testlibPartially:
+		result.Verdict = CheckerWrongAnswer
+	case code == testlibPresentationError, code == testlibUnexpectedEOF:
+		result.Verdict = CheckerPresentationError
+	default:
+		result.Verdict = CheckerFailed
+		if code != testlibFail && result.Message == "" {
+			result.Message = fmt.Sprintf("%s exited with code %d", role, code)
+		}
+	}
+
+	return result
+}
+
+// checkerMessage trims and truncates a checker's stderr for display
+func checkerMessage(stderr string) string {
+	message := strings.TrimSpace(stderr)
+	if len(message) > checkerMessageLength {
+		message = strings.ToValidUTF8(message[:checkerMessageLength], "") + "..."
+	}
+
+	return message
+}
@@ -0,0 +1,123 @@
+package sandbox
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Output comparison modes
+const (
+	CompareExact           = "exact"            // Line by line, ignoring trailing whitespace (the default)
+	CompareTokens          = "tokens"           // Token by token, ignoring all whitespace
+	CompareCaseInsensitive = "case_insensitive" // Token by token, ignoring case
+	CompareNumeric         = "numeric"          // Token by token, numbers within an absolute or relative epsilon
+)
+
+// DefaultEpsilon is the tolerance used by CompareNumeric when none is given
+const DefaultEpsilon = 1e-6
+
+// CompareOptions selects how a program's output is compared with the answer
+type CompareOptions struct {
+	Mode    string  // One of the Compare* modes, empty means CompareExact
+	Epsilon float64 // Absolute and relative tolerance for CompareNumeric, 0 means DefaultEpsilon
+}
+
+// IsCompareMode reports whether mode is a known comparison mode. The empty
+// string is accepted as CompareExact.
+func IsCompareMode(mode string) bool {
+	switch mode {
+	case "", CompareExact, CompareTokens, CompareCaseInsensitive, CompareNumeric:
+		return true
+	}
+	return false
+}
+
+// Compare compares the expected output with actual output using opts
+func Compare(expected, actual string, opts CompareOptions) bool {
+	switch opts.Mode {
+	case CompareTokens:
+		return compareTokens(expected, actual, func(e, a string) bool {
+			return e == a
+		})
+	case CompareCaseInsensitive:
+		return compareTokens(expected, actual, strings.EqualFold)
+	case CompareNumeric:
+		epsilon := opts.Epsilon
+		if epsilon <= 0 {
+			epsilon = DefaultEpsilon
+		}
+		return compareTokens(expected, actual, func(e, a string) bool {
+			return numericTokenEqual(e, a, epsilon)
+		})
+	default:
+		return CompareOutput(expected, actual)
+	}
+}
+
+// compareTokens splits both outputs on whitespace and compares them token by
+// token with equal
+func compareTokens(expected, actual string, equal func(expected, actual string) bool) bool {
+	expectedTokens := strings.Fields(expected)
+	actualTokens := strings.Fields(actual)
+	if len(expectedTokens) != len(actualTokens) {
+		return false
+	}
+
+	for i := range expectedTokens {
+		if !equal(expectedTokens[i], actualTokens[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// numericTokenEqual compares two tokens as floating-point numbers if both
+// parse as such, accepting an absolute or relative error up to epsilon.
+// Other tokens must match exactly.
+//
+// One epsilon bounds both errors, as in testlib's doubleCompare and the usual
+// "absolute or relative error 1e-6" of problem statements: the absolute error
+// decides for answers near zero and the relative one for large answers, so
+// problems rarely need two separate tolerances.
+func numericTokenEqual(expected, actual string, epsilon float64) bool {
+	if expected == actual {
+		return true
+	}
+
+	e, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	a, err := strconv.ParseFloat(actual, 64)
+	if err != nil || math.IsNaN(a) || math.IsInf(a, 0) {
+		return false
+	}
+
+	diff := math.Abs(e - a)
+	return diff <= epsilon || diff <= epsilon*math.Abs(e)
+}
+
+// FirstDifference returns the first line, counting from 1, on which actual
+// differs from expected after the normalization used by CompareExact, along
+// with both versions of that line. A missing line is returned as "".
+func FirstDifference(expected, actual string) (line int, expectedLine, actualLine string, found bool) {
+	expectedLines := strings.Split(normalizeOutput(expected), "\n")
+	actualLines := strings.Split(normalizeOutput(actual), "\n")
+
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a || i >= len(expectedLines) || i >= len(actualLines) {
+			return i + 1, e, a, true
+		}
+	}
+
+	return 0, "", "", false
+}
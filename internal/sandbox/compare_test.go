@@ -0,0 +1,108 @@
+package sandbox
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CompareOptions
+		expected string
+		actual   string
+		want     bool
+	}{
+		// exact, the default: lines must match apart from surrounding whitespace
+		{"exact same", CompareOptions{}, "1 2\n3\n", "1 2\n3\n", true},
+		{"exact trailing spaces and CRLF", CompareOptions{Mode: CompareExact}, "1 2\n3\n", "1 2  \r\n3\r\n\r\n", true},
+		{"exact inner spaces", CompareOptions{}, "1 2\n", "1  2\n", false},
+		{"exact line breaks", CompareOptions{}, "1 2\n", "1\n2\n", false},
+		{"exact case", CompareOptions{}, "YES\n", "yes\n", false},
+
+		// tokens: whitespace between tokens is ignored
+		{"tokens line breaks", CompareOptions{Mode: CompareTokens}, "1 2\n3\n", "1\n2 3", true},
+		{"tokens different", CompareOptions{Mode: CompareTokens}, "1 2 3", "1 2 4", false},
+		{"tokens missing", CompareOptions{Mode: CompareTokens}, "1 2 3", "1 2", false},
+		{"tokens extra", CompareOptions{Mode: CompareTokens}, "1 2", "1 2 3", false},
+		{"tokens case", CompareOptions{Mode: CompareTokens}, "YES", "yes", false},
+
+		// case_insensitive: tokens, ignoring case
+		{"case insensitive", CompareOptions{Mode: CompareCaseInsensitive}, "YES\nNo", "yes no\n", true},
+		{"case insensitive different", CompareOptions{Mode: CompareCaseInsensitive}, "YES", "YEP", false},
+
+		// numeric: numbers within epsilon, other tokens exactly
+		{"numeric same text", CompareOptions{Mode: CompareNumeric}, "0.5 abc", "0.5 abc", true},
+		{"numeric formatting", CompareOptions{Mode: CompareNumeric}, "0.5\n2", "5e-1 2.000", true},
+		{"numeric within default epsilon", CompareOptions{Mode: CompareNumeric}, "1.0000000", "1.0000005", true},
+		{"numeric beyond default epsilon", CompareOptions{Mode: CompareNumeric}, "1.0000000", "1.00001", false},
+		{"numeric word", CompareOptions{Mode: CompareNumeric}, "abc", "ABC", false},
+		{"numeric word for number", CompareOptions{Mode: CompareNumeric}, "1", "one", false},
+		{"numeric NaN", CompareOptions{Mode: CompareNumeric}, "1", "nan", false},
+		{"numeric infinity", CompareOptions{Mode: CompareNumeric}, "1e308", "inf", false},
+		{"numeric missing token", CompareOptions{Mode: CompareNumeric}, "1 2", "1", false},
+
+		// unknown modes compare exactly
+		{"unknown mode", CompareOptions{Mode: "other"}, "1 2", "1\n2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.expected, tt.actual, tt.opts); got != tt.want {
+				t.Errorf("Compare(%q, %q, %+v) = %v, want %v", tt.expected, tt.actual, tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNumericAbsoluteAndRelativeError checks that one epsilon bounds the
+// absolute error of small answers and the relative error of large ones
+func TestNumericAbsoluteAndRelativeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		epsilon  float64
+		expected string
+		actual   string
+		want     bool
+	}{
+		// Near zero the absolute error decides
+		{"absolute within", 1e-3, "0", "0.0009", true},
+		{"absolute beyond", 1e-3, "0", "0.0011", false},
+		{"absolute within, small answer", 1e-3, "0.001", "0.0019", true},
+		{"absolute beyond, small answer", 1e-3, "0.001", "0.0021", false},
+		{"absolute negative", 1e-3, "-0.5", "-0.5009", true},
+
+		// For large answers the relative error decides
+		{"relative within", 1e-3, "1000000", "1000900", true},
+		{"relative beyond", 1e-3, "1000000", "1001100", false},
+		{"relative negative", 1e-3, "-1000000", "-999100", true},
+		{"relative to the expected answer", 1e-3, "1000", "1001.0009", false},
+
+		// Neither error passes
+		{"both beyond", 1e-6, "123.456", "123.457", false},
+
+		// 0 uses DefaultEpsilon
+		{"default within", 0, "1", "1.0000009", true},
+		{"default beyond", 0, "1", "1.0000011", false},
+		{"default relative", 0, "1e9", "1000000999", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := CompareOptions{Mode: CompareNumeric, Epsilon: tt.epsilon}
+			if got := Compare(tt.expected, tt.actual, opts); got != tt.want {
+				t.Errorf("Compare(%q, %q) with epsilon %g = %v, want %v", tt.expected, tt.actual, tt.epsilon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCompareMode(t *testing.T) {
+	for _, mode := range []string{"", CompareExact, CompareTokens, CompareCaseInsensitive, CompareNumeric} {
+		if !IsCompareMode(mode) {
+			t.Errorf("IsCompareMode(%q) = false", mode)
+		}
+	}
+	for _, mode := range []string{"Exact", "float", "lines"} {
+		if IsCompareMode(mode) {
+			t.Errorf("IsCompareMode(%q) = true", mode)
+		}
+	}
+}
@@ -3,47 +3,130 @@ package sandbox
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// compileOutputLimit caps the compiler diagnostics kept for a submission, in bytes
+const compileOutputLimit = 64 * 1024
+
+// wallTimeFactor scales the time limit into the wall-clock limit of runs
+// that do not set one. Programs are judged by their CPU time; the wall-clock
+// limit stops programs that wait without using the CPU, such as sleeping ones.
+const wallTimeFactor = 3
+
 // ExecutionResult represents the result of a code execution
 type ExecutionResult struct {
 	Status      string
 	Output      string
 	ErrorOutput string
-	RunTime     int
+	RunTime     int // User and system CPU time in milliseconds
+	WallTime    int // Elapsed real time in milliseconds
+	Memory      int // Peak resident memory in kilobytes
 	ExitCode    int
+	Signal      string // Signal that terminated the program, such as SIGSEGV; empty if it exited
 }
 
-// CppSandbox handles safe execution of C++ code
+// RunOptions holds the limits for a single run. It is passed by value so that
+// concurrent runs never share or mutate each other's limits.
+type RunOptions struct {
+	TimeLimit     int // CPU time in milliseconds
+	WallTimeLimit int // In milliseconds, 0 means wallTimeFactor times TimeLimit
+	MemoryLimit   int // In kilobytes, 0 means unlimited
+	OutputLimit   int // In kilobytes, 0 means unlimited; also caps files the program writes
+	ProcessLimit  int // Number of processes and threads, 0 means unlimited
+
+	// Programs of problems with file I/O read their input from InputFile and
+	// write their output to OutputFile in the working directory. Empty names
+	// mean standard input and output.
+	InputFile  string
+	OutputFile string
+}
+
+// wallTimeLimit returns the wall-clock limit of a run in milliseconds
+func (o RunOptions) wallTimeLimit() int {
+	if o.WallTimeLimit > 0 {
+		return o.WallTimeLimit
+	}
+	return o.TimeLimit * wallTimeFactor
+}
+
+// CppSandbox handles safe execution of C++ code. Its fields hold the default
+// configuration and must not be modified once runs have started; a single
+// sandbox is safe for concurrent use.
 type CppSandbox struct {
 	TempDir       string
 	TimeLimit     int
 	MemoryLimit   int
+	OutputLimit   int
+	ProcessLimit  int
 	CompilerFlags []string
 	CompilerPath  string
+
+	// Isolated runs programs in their own namespaces with a minimal read-only
+	// file system and no network
+	Isolated bool
+
+	// CacheSize bounds the compile cache in TempDir, in bytes. Identical code
+	// compiled with the same compiler and flags reuses the cached build; 0
+	// turns the cache off.
+	CacheSize int64
+
+	cacheOnce sync.Once
+	cache     *artifactCache
 }
 
-// NewCppSandbox creates a new C++ sandbox
+// allowUnisolatedEnv names the environment variable that, set to 1, lets
+// NewCppSandbox run programs without isolation where it is unavailable
+const allowUnisolatedEnv = "SANDBOX_ALLOW_UNISOLATED"
+
+// NewCppSandbox creates a new C++ sandbox. It fails if programs cannot be
+// isolated, unless SANDBOX_ALLOW_UNISOLATED=1 is set.
 func NewCppSandbox() (*CppSandbox, error) {
 	tempDir, err := ioutil.TempDir("", "cppjudge-sandbox-")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
+	// Isolated programs run as an unprivileged user that must be able to reach
+	// their build and run directories
+	if err := os.Chmod(tempDir, 0711); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to set temp directory permissions: %w", err)
+	}
+
+	// Running user programs unisolated exposes the host, so it takes an
+	// explicit opt-in
+	isolated := true
+	if err := isolationSupported(); err != nil {
+		if os.Getenv(allowUnisolatedEnv) != "1" {
+			os.RemoveAll(tempDir)
+			return nil, fmt.Errorf("process isolation unavailable: %w (set %s=1 to run user programs without isolation)", err, allowUnisolatedEnv)
+		}
+		log.Printf("WARNING: process isolation unavailable, user programs will run WITHOUT namespace isolation (%s=1): %v", allowUnisolatedEnv, err)
+		isolated = false
+	}
+
 	// Default configuration
 	return &CppSandbox{
 		TempDir:       tempDir,
 		TimeLimit:     2000,   // 2 seconds
-		MemoryLimit:   256000, // 256 MB
+		MemoryLimit:   256000, // 256 MB (in kilobytes)
+		OutputLimit:   65536,  // 64 MB (in kilobytes)
+		ProcessLimit:  1,      // Single-threaded programs only
 		CompilerFlags: []string{"-std=c++17", "-O2", "-Wall"},
 		CompilerPath:  "g++",
+		Isolated:      isolated,
+		CacheSize:     512 << 20, // 512 MB
 	}, nil
 }
 
@@ -52,45 +135,185 @@ func (s *CppSandbox) Cleanup() error {
 	return os.RemoveAll(s.TempDir)
 }
 
-// Execute compiles and runs C++ code with the given input
-func (s *CppSandbox) Execute(code, input string) (ExecutionResult, error) {
-	result := ExecutionResult{}
+// compileCache returns the compile cache, or nil if it is turned off
+func (s *CppSandbox) compileCache() *artifactCache {
+	s.cacheOnce.Do(func() {
+		if s.CacheSize <= 0 {
+			return
+		}
+		dir := filepath.Join(s.TempDir, "cache")
+		if err := os.Mkdir(dir, 0711); err != nil {
+			log.Printf("WARNING: compile cache disabled: %v", err)
+			return
+		}
+		// Mkdir is subject to the umask
+		if err := os.Chmod(dir, 0711); err != nil {
+			log.Printf("WARNING: compile cache disabled: %v", err)
+			return
+		}
+		s.cache = newArtifactCache(dir, s.CacheSize)
+	})
+	return s.cache
+}
 
-	// Create unique filenames for this execution
-	id := fmt.Sprintf("%d", time.Now().UnixNano())
-	sourceFile := filepath.Join(s.TempDir, fmt.Sprintf("solution_%s.cpp", id))
-	executableFile := filepath.Join(s.TempDir, fmt.Sprintf("solution_%s.exe", id))
-	inputFile := filepath.Join(s.TempDir, fmt.Sprintf("input_%s.txt", id))
+// CacheStats returns the compile cache's hit, miss and eviction counts and
+// its current size
+func (s *CppSandbox) CacheStats() CacheStats {
+	if cache := s.compileCache(); cache != nil {
+		return cache.snapshot()
+	}
+	return CacheStats{}
+}
+
+// DefaultOptions returns the sandbox's default run limits
+func (s *CppSandbox) DefaultOptions() RunOptions {
+	return RunOptions{
+		TimeLimit:    s.TimeLimit,
+		MemoryLimit:  s.MemoryLimit,
+		OutputLimit:  s.OutputLimit,
+		ProcessLimit: s.ProcessLimit,
+	}
+}
+
+// Artifact is a compiled program that can be run against any number of inputs
+type Artifact struct {
+	dir        string
+	Executable string
+	Args       []string // Arguments passed before any others, such as the script of an interpreter
+	sanitized  bool     // Built by CompileDebug
+	release    func()   // Releases a cached build instead of removing it
+}
+
+// Cleanup removes the artifact's files, or releases them to the compile cache
+// if they came from it
+func (a *Artifact) Cleanup() error {
+	if a.release != nil {
+		a.release()
+		return nil
+	}
+	return os.RemoveAll(a.dir)
+}
+
+// CompileError is returned by Compile when the compiler rejects the source
+type CompileError struct {
+	Output string // Compiler diagnostics
+}
+
+func (e *CompileError) Error() string {
+	return "compilation failed"
+}
+
+// Compile compiles C++ code into an artifact using the sandbox's compiler and
+// flags. The caller owns the artifact and must call Cleanup when done. If the
+// code does not compile, the returned error is a *CompileError holding the
+// compiler output.
+func (s *CppSandbox) Compile(code string) (*Artifact, error) {
+	language := Language{
+		ID:          DefaultLanguage,
+		SourceFile:  "solution.cpp",
+		Compiler:    s.CompilerPath,
+		CompileArgs: []string{"-o", executablePlaceholder, sourcePlaceholder},
+	}
+	return s.CompileLanguage(language, s.CompilerFlags, code)
+}
+
+// CompileLanguage builds code written in the given language into an
+// artifact, passing flags (usually those of a compiler profile) to the
+// compiler. Sources of interpreted languages are only checked for syntax
+// errors. Successful builds are taken from and kept in the compile cache.
+// Errors are reported as by Compile.
+func (s *CppSandbox) CompileLanguage(language Language, flags []string, code string) (*Artifact, error) {
+	if cache := s.compileCache(); cache != nil {
+		return cache.get(cacheKey(language, flags, code), func(dir string) (*Artifact, error) {
+			return s.build(dir, language, flags, code)
+		})
+	}
+
+	dir, err := ioutil.TempDir(s.TempDir, "build-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0711); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to set build directory permissions: %w", err)
+	}
+
+	artifact, err := s.build(dir, language, flags, code)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// build compiles code into an artifact in dir. The caller removes dir if the
+// build fails.
+func (s *CppSandbox) build(dir string, language Language, flags []string, code string) (*Artifact, error) {
+	artifact := &Artifact{
+		dir:        dir,
+		Executable: filepath.Join(dir, "solution.exe"),
+	}
+	sourceFile := filepath.Join(dir, language.SourceFile)
+
+	// Interpreted programs are run by the interpreter, which also checks them
+	compiler := language.Compiler
+	if language.Interpreter != "" {
+		interpreter, err := findInterpreter(language.Interpreter)
+		if err != nil {
+			return nil, err
+		}
+		compiler = interpreter
+		artifact.Executable = interpreter
+		artifact.Args = expandArgs(language.RunArgs, sourceFile, "")
+	}
 
 	// Write the source code to file
 	if err := ioutil.WriteFile(sourceFile, []byte(code), 0644); err != nil {
-		return result, fmt.Errorf("failed to write source file: %w", err)
+		return nil, fmt.Errorf("failed to write source file: %w", err)
 	}
 
-	// Write the input to file
-	if err := ioutil.WriteFile(inputFile, []byte(input), 0644); err != nil {
-		return result, fmt.Errorf("failed to write input file: %w", err)
+	// Compile the code
+	args := append(append([]string{}, flags...), expandArgs(language.CompileArgs, sourceFile, artifact.Executable)...)
+	compileOutput, err := s.compile(compiler, args)
+	if err != nil {
+		// Diagnostics refer to the source file rather than the build directory
+		return nil, &CompileError{Output: strings.ReplaceAll(compileOutput, dir+string(filepath.Separator), "")}
 	}
 
-	// Compile the code
-	compileResult, err := s.compile(sourceFile, executableFile)
+	return artifact, nil
+}
+
+// Run executes a compiled artifact with the given input and limits. Each run
+// gets its own working directory, so an artifact may be run concurrently.
+func (s *CppSandbox) Run(artifact *Artifact, input string, opts RunOptions) (ExecutionResult, error) {
+	return s.run(artifact, nil, nil, input, nil, opts)
+}
+
+// Execute compiles and runs C++ code with the given input
+func (s *CppSandbox) Execute(code, input string) (ExecutionResult, error) {
+	result := ExecutionResult{}
+
+	artifact, err := s.Compile(code)
 	if err != nil {
-		result.Status = "Compilation Error"
-		result.ErrorOutput = compileResult
-		return result, nil
+		var compileErr *CompileError
+		if errors.As(err, &compileErr) {
+			result.Status = "Compilation Error"
+			result.ErrorOutput = compileErr.Output
+			return result, nil
+		}
+		return result, err
 	}
+	defer artifact.Cleanup()
 
 	// Run the code
-	return s.run(executableFile, inputFile)
+	return s.Run(artifact, input, s.DefaultOptions())
 }
 
-// compile compiles the C++ source code
-func (s *CppSandbox) compile(sourceFile, executableFile string) (string, error) {
-	args := append(s.CompilerFlags, "-o", executableFile, sourceFile)
-
-	cmd := exec.Command(s.CompilerPath, args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// compile runs a compiler with the given arguments
+func (s *CppSandbox) compile(compiler string, args []string) (string, error) {
+	cmd := exec.Command(compiler, args...)
+	stderr := &limitedBuffer{limit: compileOutputLimit}
+	cmd.Stderr = stderr
 
 	err := cmd.Run()
 	if err != nil {
@@ -100,67 +323,243 @@ func (s *CppSandbox) compile(sourceFile, executableFile string) (string, error)
 	return "", nil
 }
 
-// run executes the compiled binary with the provided input
-func (s *CppSandbox) run(executableFile, inputFile string) (ExecutionResult, error) {
-	result := ExecutionResult{}
+// pipeEnds connects a run's standard input and output to another program
+// instead of the input string and the captured output
+type pipeEnds struct {
+	Stdin  *os.File
+	Stdout *os.File
+}
 
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.TimeLimit)*time.Millisecond)
-	defer cancel()
+// close releases the server's copies of the pipe ends, so that the other
+// program sees end of file or a broken pipe once this one is gone
+func (p *pipeEnds) close() {
+	if p != nil {
+		p.Stdin.Close()
+		p.Stdout.Close()
+	}
+}
+
+// run executes an artifact with the provided arguments and input. files are
+// written into the working directory before the program starts. If pipes is
+// not nil, the program talks through it and input is ignored; the pipe ends
+// are closed when run returns.
+func (s *CppSandbox) run(artifact *Artifact, args []string, files map[string]string, input string, pipes *pipeEnds, opts RunOptions) (ExecutionResult, error) {
+	defer pipes.close()
+	result := ExecutionResult{}
 
-	// Read input file
-	input, err := ioutil.ReadFile(inputFile)
+	// Give the run a private working directory
+	runDir, err := ioutil.TempDir(s.TempDir, "run-")
 	if err != nil {
-		return result, fmt.Errorf("failed to read input file: %w", err)
+		return result, fmt.Errorf("failed to create run directory: %w", err)
+	}
+	defer os.RemoveAll(runDir)
+
+	for _, name := range []string{opts.InputFile, opts.OutputFile} {
+		if name != "" && !isPlainFileName(name) {
+			return result, fmt.Errorf("invalid I/O file name %q", name)
+		}
+	}
+	if opts.InputFile != "" {
+		files = withFile(files, opts.InputFile, input)
+		input = ""
 	}
 
-	// Create command
-	cmd := exec.CommandContext(ctx, executableFile)
-	cmd.Stdin = bytes.NewBuffer(input)
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(runDir, name), []byte(content), 0644); err != nil {
+			return result, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// The context stops programs at the wall-clock limit
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.wallTimeLimit())*time.Millisecond)
+	defer cancel()
 
-	// Set resource limits if possible
-	// Note: This is platform-dependent and may require additional libraries
-	// For production, consider using cgroups, Docker, or other containerization
+	// Programs whose static data alone exceeds the limit cannot even be loaded
+	if static := staticMemory(artifact.Executable); opts.MemoryLimit > 0 && static > opts.MemoryLimit {
+		result.Status = "Memory Limit Exceeded"
+		result.Memory = static
+		return result, nil
+	}
+
+	// The address space and stack are capped at the memory limit
+	cfg := programConfig{
+		Executable:   artifact.Executable,
+		Args:         append(append([]string{}, artifact.Args...), args...),
+		ProgramDir:   artifact.dir,
+		Dir:          runDir,
+		TimeLimit:    opts.TimeLimit,
+		MemoryLimit:  opts.MemoryLimit,
+		FileLimit:    opts.OutputLimit,
+		ProcessLimit: opts.ProcessLimit,
+		Isolated:     s.Isolated,
+	}
+	if artifact.sanitized {
+		cfg.Sanitized = true
+		cfg.Env = sanitizerEnv(opts.MemoryLimit)
+		if cfg.ProcessLimit > 0 {
+			cfg.ProcessLimit += sanitizerProcessSlack
+		}
+	}
+
+	// Output beyond the limit is discarded and the program stopped at once,
+	// so that a printing loop cannot fill the server's memory
+	stdout := &limitedBuffer{limit: opts.OutputLimit * 1024, onExceed: cancel}
+	stderr := &limitedBuffer{limit: opts.OutputLimit * 1024, onExceed: cancel}
+	var programStdin io.Reader = strings.NewReader(input)
+	var programStdout io.Writer = stdout
+	if pipes != nil {
+		programStdin, programStdout = pipes.Stdin, pipes.Stdout
+	}
 
 	// Start timer
 	startTime := time.Now()
 
-	// Run the command
-	err = cmd.Run()
+	// Run the program
+	state, err := runProgram(ctx, cfg, programStdin, programStdout, stderr)
+	if err != nil {
+		return result, err
+	}
 
-	// Calculate execution time
-	runTime := time.Since(startTime)
-	result.RunTime = int(runTime.Milliseconds())
+	result.WallTime = int(time.Since(startTime).Milliseconds())
+	result.RunTime = state.CPUTime
+	result.Memory = state.Memory
+	if state.Signal != 0 {
+		result.Signal = signalName(state.Signal)
+	}
+	// Output produced before a failure is kept for diagnostics
+	result.Output = stdout.String()
+	if opts.OutputFile != "" {
+		if result.Output, err = readOutputFile(filepath.Join(runDir, opts.OutputFile)); err != nil {
+			return result, err
+		}
+	}
+	failed := state.Signal != 0 || state.ExitCode != 0
+
+	// Programs stopped for printing or writing too much
+	if stdout.exceeded || stderr.exceeded || state.FileTooBig {
+		result.Status = "Output Limit Exceeded"
+		result.ErrorOutput = stderr.String()
+		return result, nil
+	}
 
-	// Check for timeout
-	if ctx.Err() == context.DeadlineExceeded {
+	// Check for timeout, either by CPU time or at the wall-clock limit. The
+	// CPU time of programs killed at the wall-clock limit is unknown.
+	if ctx.Err() == context.DeadlineExceeded || state.CPUTime > opts.TimeLimit {
+		if ctx.Err() == context.DeadlineExceeded {
+			result.RunTime = result.WallTime
+		}
 		result.Status = "Time Limit Exceeded"
+		result.ErrorOutput = stderr.String()
+		return result, nil
+	}
+
+	// Check for memory limit, either measured or reported by a failed allocation
+	memoryLimit := opts.MemoryLimit
+	if artifact.sanitized {
+		memoryLimit *= sanitizerMemoryFactor
+	}
+	if opts.MemoryLimit > 0 && (result.Memory > memoryLimit || (failed && isAllocationFailure(stderr.String()))) {
+		result.Status = "Memory Limit Exceeded"
+		result.ErrorOutput = stderr.String()
+		return result, nil
+	}
+
+	// Programs killed by the seccomp filter tried a forbidden syscall
+	if state.Restricted {
+		result.Status = "Restricted Function"
+		result.ExitCode = -1
+		result.ErrorOutput = stderr.String()
 		return result, nil
 	}
 
 	// Check for runtime errors
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-			result.Status = "Runtime Error"
-			result.ErrorOutput = stderr.String()
-			return result, nil
-		}
-		return result, err
+	if failed {
+		result.ExitCode = state.ExitCode
+		result.Status = "Runtime Error"
+		result.ErrorOutput = stderr.String()
+		return result, nil
 	}
 
 	// Success
 	result.Status = "Success"
-	result.Output = stdout.String()
+	result.ErrorOutput = stderr.String()
 	result.ExitCode = 0
 
 	return result, nil
 }
 
+// isPlainFileName reports whether name names a file directly inside a
+// directory, without any path components
+func isPlainFileName(name string) bool {
+	return name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// withFile returns a copy of files that also holds the named file
+func withFile(files map[string]string, name, content string) map[string]string {
+	copied := make(map[string]string, len(files)+1)
+	for n, c := range files {
+		copied[n] = c
+	}
+	copied[name] = content
+	return copied
+}
+
+// readOutputFile reads the output file a program wrote. A missing file, or
+// anything but a regular file, counts as empty output. Its size is already
+// capped by the file size limit of the program.
+func readOutputFile(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect output file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read output file: %w", err)
+	}
+	return string(data), nil
+}
+
+// limitedBuffer collects output and drops writes beyond limit bytes. The
+// first write that does not fit sets exceeded and calls onExceed, if set.
+// The bytes.Buffer is not embedded, as io.Copy would bypass Write through
+// its ReadFrom method.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int // 0 means unlimited
+	exceeded bool
+	onExceed func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+			if remaining > 0 {
+				b.buf.Write(p[:remaining])
+			}
+			if !b.exceeded {
+				b.exceeded = true
+				if b.onExceed != nil {
+					b.onExceed()
+				}
+			}
+			return len(p), nil
+		}
+	}
+	return b.buf.Write(p)
+}
+
+// String returns the collected output
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
 // CompareOutput compares the expected output with actual output
 func CompareOutput(expected, actual string) bool {
 	// Normalize line endings and whitespace
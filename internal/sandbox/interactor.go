@@ -0,0 +1,90 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+)
+
+// interactorWallSlack is added to the program's wall-clock limit for the
+// interactor, so that a program stopped at its limit is reported as such
+// rather than as a stalled interactor
+const interactorWallSlack = 2000 // In milliseconds
+
+// InteractResult is the outcome of running a program against an interactor
+type InteractResult struct {
+	Program ExecutionResult // The program's run; its Output is always empty
+	Verdict string          // The interactor's verdict, one of the Checker verdicts
+	Message string          // Interactor feedback, as written to stderr by testlib
+}
+
+// Interact runs a program together with a compiled interactor, the program's
+// standard output connected to the interactor's standard input and the other
+// way round. The interactor is invoked like a testlib interactor,
+// `interactor input.txt output.txt answer.txt`, and its exit code decides the
+// verdict; it runs under the checker's limits and outlives the program's
+// wall-clock limit. A program that never flushes its output simply times out.
+func (s *CppSandbox) Interact(program, interactor *Artifact, input, answer string, opts RunOptions) (InteractResult, error) {
+	result := InteractResult{}
+
+	// The program talks only to the interactor
+	opts.InputFile = ""
+	opts.OutputFile = ""
+
+	interactorOpts := s.DefaultOptions()
+	interactorOpts.TimeLimit = checkerTimeLimit
+	interactorOpts.WallTimeLimit = opts.wallTimeLimit() + interactorWallSlack
+
+	toInteractor, err := newPipe()
+	if err != nil {
+		return result, err
+	}
+	toProgram, err := newPipe()
+	if err != nil {
+		toInteractor.close()
+		return result, err
+	}
+
+	files := map[string]string{
+		checkerInputFile:  input,
+		checkerAnswerFile: answer,
+	}
+	args := []string{checkerInputFile, checkerOutputFile, checkerAnswerFile}
+
+	// Each run closes its pipe ends when it is done, so neither side can wait
+	// for a program that is already gone
+	type interactorRun struct {
+		result ExecutionResult
+		err    error
+	}
+	done := make(chan interactorRun, 1)
+	go func() {
+		execResult, err := s.run(interactor, args, files, "", &pipeEnds{Stdin: toInteractor.Stdin, Stdout: toProgram.Stdout}, interactorOpts)
+		done <- interactorRun{execResult, err}
+	}()
+
+	programResult, programErr := s.run(program, nil, nil, "", &pipeEnds{Stdin: toProgram.Stdin, Stdout: toInteractor.Stdout}, opts)
+	interactorResult := <-done
+	if programErr != nil {
+		return result, programErr
+	}
+	if interactorResult.err != nil {
+		return result, interactorResult.err
+	}
+
+	result.Program = programResult
+	verdict := testlibVerdict("interactor", interactorResult.result)
+	result.Verdict = verdict.Verdict
+	result.Message = verdict.Message
+
+	return result, nil
+}
+
+// newPipe creates a pipe, returned as the read end in Stdin and the write end
+// in Stdout
+func newPipe() (*pipeEnds, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create interaction pipe: %w", err)
+	}
+	return &pipeEnds{Stdin: reader, Stdout: writer}, nil
+}
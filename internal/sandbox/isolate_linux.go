@@ -0,0 +1,343 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// overflowID is the host user and group ("nobody") that programs run as when
+// the server itself runs as root
+const overflowID = 65534
+
+// systemPaths are bind-mounted read-only into the minimal root so that
+// compilers' runtime libraries and interpreters are available
+var systemPaths = []string{
+	"/bin",
+	"/sbin",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/usr",
+	"/etc/alternatives",
+	"/etc/ld.so.cache",
+}
+
+// devicePaths are the only devices visible to programs
+var devicePaths = []string{
+	"/dev/null",
+	"/dev/zero",
+	"/dev/random",
+	"/dev/urandom",
+}
+
+// isolationSupported checks that programs can be run in new namespaces by
+// running a trivial program isolated
+func isolationSupported() error {
+	dir, err := os.MkdirTemp("", "cppjudge-probe-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0711); err != nil {
+		return err
+	}
+
+	executable, err := exec.LookPath("true")
+	if err != nil {
+		return err
+	}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	state, err := runProgram(ctx, programConfig{
+		Executable:   executable,
+		Dir:          workDir,
+		ProcessLimit: 1,
+		Isolated:     true,
+	}, nil, io.Discard, io.Discard)
+	if err != nil {
+		return err
+	}
+	if state.ExitCode != 0 || state.Signal != 0 {
+		return fmt.Errorf("probe program failed: exit code %d, signal %v", state.ExitCode, state.Signal)
+	}
+
+	return nil
+}
+
+// prepareIsolation configures attr to start the init helper in new
+// namespaces and creates the mount point for the new root. The returned
+// function removes it again.
+func prepareIsolation(hc *helperConfig, cfg programConfig, attr *syscall.SysProcAttr) (string, func(), error) {
+	hostUID, hostGID := os.Getuid(), os.Getgid()
+	if hostUID == 0 {
+		// Never run user programs as the host's root
+		hostUID, hostGID = overflowID, overflowID
+		if err := os.Chown(cfg.Dir, hostUID, hostGID); err != nil {
+			return "", nil, fmt.Errorf("failed to hand over work directory: %w", err)
+		}
+	}
+
+	rootDir, err := os.MkdirTemp(filepath.Dir(cfg.Dir), "root-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create root mount point: %w", err)
+	}
+	if err := os.Chmod(rootDir, 0755); err != nil {
+		os.Remove(rootDir)
+		return "", nil, fmt.Errorf("failed to create root mount point: %w", err)
+	}
+
+	// Inside the namespaces the program lives at /program and works in /sandbox
+	hc.WorkDir = cfg.Dir
+	hc.ProgramDir = cfg.ProgramDir
+	hc.Executable = programPath(cfg.ProgramDir, cfg.Executable)
+	hc.Args = make([]string, len(cfg.Args))
+	for i, arg := range cfg.Args {
+		hc.Args[i] = programPath(cfg.ProgramDir, arg)
+	}
+	if hc.ProcessLimit > 0 {
+		// The init helper counts towards the limit as well
+		hc.ProcessLimit++
+	}
+
+	attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET |
+		syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostUID, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostGID, Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	attr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}
+
+	return rootDir, func() { os.Remove(rootDir) }, nil
+}
+
+// programPath translates a host path inside the program directory to its
+// path in the isolated root. Other paths, such as system interpreters and
+// plain arguments, are returned unchanged.
+func programPath(programDir, path string) string {
+	rel, err := filepath.Rel(programDir, path)
+	if err != nil || !filepath.IsAbs(path) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join("/program", rel)
+}
+
+// runInitHelper runs as PID 1 of the new namespaces. It builds the minimal
+// read-only root, starts the exec helper inside it and reports the program's
+// outcome. It never returns.
+func runInitHelper(encoded string) {
+	runtime.LockOSThread()
+
+	var hc helperConfig
+	if err := json.Unmarshal([]byte(encoded), &hc); err != nil {
+		helperFail("sandbox init: invalid config: %v", err)
+	}
+
+	if err := buildRoot(hc); err != nil {
+		helperFail("sandbox init: %v", err)
+	}
+	if err := syscall.Sethostname([]byte("sandbox")); err != nil {
+		helperFail("sandbox init: sethostname: %v", err)
+	}
+
+	// Start the exec helper; it reports failures on its own descriptor 3
+	reportReader, reportWriter, err := os.Pipe()
+	if err != nil {
+		helperFail("sandbox init: pipe: %v", err)
+	}
+
+	execConfig, _ := json.Marshal(helperConfig{
+		Executable:   hc.Executable,
+		Args:         hc.Args,
+		TimeLimit:    hc.TimeLimit,
+		MemoryLimit:  hc.MemoryLimit,
+		FileLimit:    hc.FileLimit,
+		ProcessLimit: hc.ProcessLimit,
+		Sanitized:    hc.Sanitized,
+	})
+	process, err := os.StartProcess("/proc/self/exe", []string{execHelperName, string(execConfig)}, &os.ProcAttr{
+		Dir:   "/sandbox",
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr, reportWriter},
+		Sys:   &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL},
+	})
+	if err != nil {
+		helperFail("sandbox init: start program: %v", err)
+	}
+	reportWriter.Close()
+	os.Stdin.Close()
+	os.Stdout.Close()
+	os.Stderr.Close()
+
+	// As PID 1 we reap every process until the program itself exits
+	var status syscall.WaitStatus
+	var usage syscall.Rusage
+	for {
+		pid, err := syscall.Wait4(-1, &status, 0, &usage)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			helperFail("sandbox init: wait: %v", err)
+		}
+		if pid == process.Pid {
+			break
+		}
+	}
+
+	data, _ := io.ReadAll(reportReader)
+	if len(data) > 0 {
+		// The exec helper failed before running the program; pass its report on
+		f := os.NewFile(helperReportFD, "report")
+		f.Write(data)
+		f.Close()
+		os.Exit(127)
+	}
+
+	state := stateFromProcess(status, &usage)
+	writeReport(helperReport{State: &state})
+	os.Exit(0)
+}
+
+// buildRoot mounts a tmpfs on hc.RootDir, populates it with the system paths,
+// devices, /proc, the program directory and the work directory, and makes it
+// the root of the mount namespace
+func buildRoot(hc helperConfig) error {
+	root := hc.RootDir
+
+	// Keep our mounts from propagating back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=755"); err != nil {
+		return fmt.Errorf("mount root tmpfs: %w", err)
+	}
+
+	for _, path := range systemPaths {
+		if err := bindIntoRoot(root, path, path, true); err != nil {
+			return err
+		}
+	}
+	for _, path := range devicePaths {
+		if err := bindIntoRoot(root, path, path, path != "/dev/null"); err != nil {
+			return err
+		}
+	}
+	if err := bindIntoRoot(root, hc.ProgramDir, "/program", true); err != nil {
+		return err
+	}
+	if err := bindIntoRoot(root, hc.WorkDir, "/sandbox", false); err != nil {
+		return err
+	}
+
+	procDir := filepath.Join(root, "proc")
+	if err := os.Mkdir(procDir, 0555); err != nil {
+		return fmt.Errorf("create /proc: %w", err)
+	}
+	if err := syscall.Mount("proc", procDir, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+
+	// Switch to the new root and detach the host's file system
+	oldRoot := filepath.Join(root, ".old")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return fmt.Errorf("create old root: %w", err)
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return fmt.Errorf("chdir: %w", err)
+	}
+	if err := syscall.Unmount("/.old", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount old root: %w", err)
+	}
+	if err := os.Remove("/.old"); err != nil {
+		return fmt.Errorf("remove old root: %w", err)
+	}
+
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount root read-only: %w", err)
+	}
+
+	return nil
+}
+
+// bindIntoRoot bind-mounts source from the host at target inside root.
+// Symbolic links are recreated instead and missing sources are skipped.
+func bindIntoRoot(root, source, target string, readOnly bool) error {
+	info, err := os.Lstat(source)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", source, err)
+	}
+
+	dest := filepath.Join(root, target)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return fmt.Errorf("readlink %s: %w", source, err)
+		}
+		return os.Symlink(link, dest)
+	}
+
+	if info.IsDir() {
+		err = os.Mkdir(dest, 0755)
+	} else {
+		var f *os.File
+		f, err = os.Create(dest)
+		if err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+
+	if err := syscall.Mount(source, dest, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", source, err)
+	}
+
+	// Remounting must keep the flags the host mount is locked with
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(source, &fs); err != nil {
+		return fmt.Errorf("statfs %s: %w", source, err)
+	}
+	flags := uintptr(syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_NOSUID) | lockedMountFlags(fs.Flags)
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("", dest, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// lockedMountFlags extracts the statfs flags that a remount in a user
+// namespace has to preserve. The ST_* and MS_* values coincide for these bits.
+func lockedMountFlags(statfsFlags int64) uintptr {
+	const locked = syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+	return uintptr(statfsFlags) & locked
+}
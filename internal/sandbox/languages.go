@@ -0,0 +1,161 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Placeholders in Language.CompileArgs and Language.RunArgs
+const (
+	sourcePlaceholder     = "{source}"
+	executablePlaceholder = "{executable}"
+)
+
+// DefaultLanguage is used for submissions that do not name a language
+const DefaultLanguage = "cpp17"
+
+// Language describes how to build and run programs written in one language
+type Language struct {
+	ID         string `json:"id"`   // Value stored in Submission.Language
+	Name       string `json:"name"` // Display name
+	SourceFile string `json:"-"`    // Name of the source file in the build directory
+
+	// Compiler builds the source with the flags of a compiler profile
+	// followed by CompileArgs. Interpreted languages have no compiler; the
+	// Interpreter is run with CompileArgs instead to check the syntax, so that
+	// mistakes show up as compilation errors.
+	Compiler    string   `json:"-"`
+	CompileArgs []string `json:"-"`
+
+	// DefaultProfile is the compiler profile used when a submission does not
+	// choose one
+	DefaultProfile string `json:"default_profile"`
+
+	// Interpreter runs the source with RunArgs; empty for compiled languages,
+	// which run the compiler's output directly
+	Interpreter string   `json:"-"`
+	RunArgs     []string `json:"-"`
+
+	// TimeFactor scales the problem's time limit for slower languages
+	TimeFactor float64 `json:"time_factor"`
+}
+
+// cppLanguage returns a C++ language whose default profile is defaultProfile
+func cppLanguage(id, name, defaultProfile string) Language {
+	return Language{
+		ID:             id,
+		Name:           name,
+		SourceFile:     "solution.cpp",
+		Compiler:       "g++",
+		CompileArgs:    []string{"-o", executablePlaceholder, sourcePlaceholder},
+		DefaultProfile: defaultProfile,
+		TimeFactor:     1,
+	}
+}
+
+// languages is the registry of supported languages, by ID
+var languages = map[string]Language{
+	"c11": {
+		ID:             "c11",
+		Name:           "C11",
+		SourceFile:     "solution.c",
+		Compiler:       "gcc",
+		CompileArgs:    []string{"-o", executablePlaceholder, sourcePlaceholder, "-lm"},
+		DefaultProfile: "c11-o2",
+		TimeFactor:     1,
+	},
+	"cpp11": cppLanguage("cpp11", "C++11", "cpp11-o2"),
+	"cpp14": cppLanguage("cpp14", "C++14", "cpp14-o2"),
+	"cpp17": cppLanguage("cpp17", "C++17", "cpp17-o2"),
+	"cpp20": cppLanguage("cpp20", "C++20", "cpp20-o2"),
+	"python3": {
+		ID:             "python3",
+		Name:           "Python 3",
+		SourceFile:     "solution.py",
+		CompileArgs:    []string{"-m", "py_compile", sourcePlaceholder},
+		Interpreter:    "python3",
+		RunArgs:        []string{sourcePlaceholder},
+		DefaultProfile: "python3",
+		TimeFactor:     3,
+	},
+}
+
+// languageAliases maps shorter names, including the "cpp" stored by older
+// submissions, to language IDs
+var languageAliases = map[string]string{
+	"c":      "c11",
+	"cpp":    "cpp17",
+	"c++":    "cpp17",
+	"python": "python3",
+}
+
+// LookupLanguage returns the language with the given ID or alias. An empty
+// ID selects DefaultLanguage.
+func LookupLanguage(id string) (Language, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		id = DefaultLanguage
+	}
+	if alias, ok := languageAliases[id]; ok {
+		id = alias
+	}
+
+	language, ok := languages[id]
+	return language, ok
+}
+
+// Languages returns all supported languages sorted by ID
+func Languages() []Language {
+	list := make([]Language, 0, len(languages))
+	for _, language := range languages {
+		list = append(list, language)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// TimeLimit scales a time limit in milliseconds by the language's time factor
+func (l Language) TimeLimit(timeLimit int) int {
+	if l.TimeFactor <= 0 {
+		return timeLimit
+	}
+	return int(float64(timeLimit) * l.TimeFactor)
+}
+
+// expandArgs substitutes the source and executable placeholders in args
+func expandArgs(args []string, source, executable string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, sourcePlaceholder, source)
+		expanded[i] = strings.ReplaceAll(arg, executablePlaceholder, executable)
+	}
+	return expanded
+}
+
+// findInterpreter resolves an interpreter on the PATH that user programs
+// see, rather than the server's own PATH, and follows symbolic links so that
+// the resulting file is reachable inside the isolated root
+func findInterpreter(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return filepath.EvalSymlinks(name)
+	}
+
+	for _, env := range programEnv {
+		if !strings.HasPrefix(env, "PATH=") {
+			continue
+		}
+		for _, dir := range filepath.SplitList(strings.TrimPrefix(env, "PATH=")) {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				return filepath.EvalSymlinks(path)
+			}
+		}
+	}
+
+	return "", fmt.Errorf("interpreter %s not found", name)
+}
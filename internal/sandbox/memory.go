@@ -0,0 +1,40 @@
+package sandbox
+
+import (
+	"debug/elf"
+	"strings"
+)
+
+// addressSpaceSlack is added on top of the memory limit (in kilobytes) when
+// capping the address space, covering the C++ runtime and shared libraries
+const addressSpaceSlack = 16 * 1024
+
+// staticMemory returns the size in kilobytes of the loadable segments of an
+// executable, i.e. the memory taken by code and global arrays before main runs.
+// Non-ELF binaries report 0.
+func staticMemory(executableFile string) int {
+	f, err := elf.Open(executableFile)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	var total uint64
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			total += prog.Memsz
+		}
+	}
+
+	return int(total / 1024)
+}
+
+// isAllocationFailure reports whether stderr shows that the program died
+// because an allocation was refused by the memory limit: an uncaught
+// std::bad_alloc in C++, a MemoryError traceback in Python, or the sanitizer
+// runtime of a debug build refusing an allocation or stopping the program
+func isAllocationFailure(stderr string) bool {
+	return strings.Contains(stderr, "std::bad_alloc") || strings.Contains(stderr, "\nMemoryError") ||
+		strings.Contains(stderr, "AddressSanitizer: requested allocation size") ||
+		strings.Contains(stderr, "AddressSanitizer: hard rss limit exhausted")
+}
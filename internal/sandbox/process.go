@@ -0,0 +1,64 @@
+package sandbox
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// programConfig describes how to start a user program
+type programConfig struct {
+	Executable   string   // Path of the executable on the host
+	Args         []string // Command-line arguments after the program name
+	ProgramDir   string   // Host directory holding the program's files, read-only to the program
+	Dir          string   // Working directory on the host, the only place the program may write
+	TimeLimit    int      // CPU time in milliseconds, 0 means unlimited; enforced in whole seconds
+	MemoryLimit  int      // In kilobytes, 0 means unlimited
+	FileLimit    int      // Largest file the program may write, in kilobytes, 0 means unlimited
+	ProcessLimit int      // Maximum number of processes and threads, 0 means unlimited
+	Isolated     bool     // Run in new namespaces with a minimal read-only root
+	Env          []string // Added to programEnv
+
+	// Sanitized programs reserve terabytes of address space for shadow
+	// memory, so the address space is not capped for them
+	Sanitized bool
+}
+
+// programState is the outcome of a finished user program
+type programState struct {
+	ExitCode   int            `json:"exit_code"`    // -1 if the program was killed by a signal
+	Signal     syscall.Signal `json:"signal"`       // Terminating signal, 0 if the program exited
+	Memory     int            `json:"memory"`       // Peak resident memory in kilobytes
+	CPUTime    int            `json:"cpu_time"`     // User and system CPU time in milliseconds
+	Restricted bool           `json:"restricted"`   // Killed by the seccomp filter for a forbidden syscall
+	FileTooBig bool           `json:"file_too_big"` // Killed for writing beyond the file size limit
+}
+
+// programEnv is the complete environment of user programs, so that nothing
+// (such as API keys) leaks from the server's environment
+var programEnv = []string{
+	"PATH=/usr/local/bin:/usr/bin:/bin",
+	"LANG=C.UTF-8",
+	// Without HOME, interpreters look the home directory up in the user
+	// database, which may need sockets that the seccomp filter forbids
+	"HOME=/sandbox",
+}
+
+// signalNames are the names of the signals that commonly end user programs
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGPIPE: "SIGPIPE",
+}
+
+// signalName returns the conventional name of sig, such as SIGSEGV
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
@@ -0,0 +1,274 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The server re-executes itself through /proc/self/exe to prepare user
+// programs; argv[0] selects the helper stage:
+//
+//   - initHelperName runs as PID 1 of the new namespaces, builds the minimal
+//     root and starts the exec helper inside it (isolated runs only)
+//   - execHelperName applies rlimits and the seccomp filter and replaces
+//     itself with the user program
+//
+// Both stages report back on file descriptor 3 (helperReportFD).
+const (
+	initHelperName = "cppjudge-sandbox-init"
+	execHelperName = "cppjudge-sandbox-exec"
+	helperReportFD = 3
+)
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package does not define
+const rlimitNproc = 6
+
+func init() {
+	// Signals missing from the portable list in process.go
+	signalNames[syscall.SIGXCPU] = "SIGXCPU"
+	signalNames[syscall.SIGSYS] = "SIGSYS"
+	signalNames[syscall.SIGXFSZ] = "SIGXFSZ"
+}
+
+// rlimit is a resource limit applied by the exec helper
+type rlimit struct {
+	resource int
+	value    uint64
+}
+
+// helperConfig is passed as JSON in argv[1] of the helper stages
+type helperConfig struct {
+	Executable   string   `json:"executable"`
+	Args         []string `json:"args"`
+	TimeLimit    int      `json:"time_limit"`
+	MemoryLimit  int      `json:"memory_limit"`
+	FileLimit    int      `json:"file_limit"`
+	ProcessLimit int      `json:"process_limit"`
+	Sanitized    bool     `json:"sanitized,omitempty"`
+	WorkDir      string   `json:"work_dir,omitempty"`    // init only: host directory mounted at /sandbox
+	ProgramDir   string   `json:"program_dir,omitempty"` // init only: host directory mounted at /program
+	RootDir      string   `json:"root_dir,omitempty"`    // init only: empty directory the new root is mounted on
+}
+
+// helperReport is written by a helper on helperReportFD. The exec helper only
+// writes a report when it fails; a successful exec closes the descriptor.
+type helperReport struct {
+	Error string        `json:"error,omitempty"`
+	State *programState `json:"state,omitempty"`
+}
+
+func init() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	switch os.Args[0] {
+	case initHelperName:
+		runInitHelper(os.Args[1])
+	case execHelperName:
+		runExecHelper(os.Args[1])
+	}
+}
+
+// runProgram runs a user program under the limits in cfg and waits for it to
+// finish or for ctx to be done. The returned error reports a failure of the
+// sandbox itself, not of the program.
+func runProgram(ctx context.Context, cfg programConfig, stdin io.Reader, stdout, stderr io.Writer) (programState, error) {
+	hc := helperConfig{
+		Executable:   cfg.Executable,
+		Args:         cfg.Args,
+		TimeLimit:    cfg.TimeLimit,
+		MemoryLimit:  cfg.MemoryLimit,
+		FileLimit:    cfg.FileLimit,
+		ProcessLimit: cfg.ProcessLimit,
+		Sanitized:    cfg.Sanitized,
+	}
+	helperName := execHelperName
+	attr := &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+
+	if cfg.Isolated {
+		rootDir, cleanup, err := prepareIsolation(&hc, cfg, attr)
+		if err != nil {
+			return programState{}, err
+		}
+		defer cleanup()
+		hc.RootDir = rootDir
+		helperName = initHelperName
+	} else {
+		// RLIMIT_NPROC counts every process of the host user, so it is only
+		// meaningful inside a user namespace of our own
+		hc.ProcessLimit = 0
+	}
+
+	encoded, err := json.Marshal(hc)
+	if err != nil {
+		return programState{}, fmt.Errorf("failed to encode helper config: %w", err)
+	}
+
+	reportReader, reportWriter, err := os.Pipe()
+	if err != nil {
+		return programState{}, fmt.Errorf("failed to create report pipe: %w", err)
+	}
+	defer reportReader.Close()
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", string(encoded))
+	cmd.Args[0] = helperName
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(append([]string{}, programEnv...), cfg.Env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.ExtraFiles = []*os.File{reportWriter}
+	cmd.SysProcAttr = attr
+
+	if err := cmd.Start(); err != nil {
+		reportWriter.Close()
+		return programState{}, fmt.Errorf("failed to start sandbox helper: %w", err)
+	}
+	reportWriter.Close()
+
+	waitErr := cmd.Wait()
+
+	var report helperReport
+	data, _ := io.ReadAll(reportReader)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &report); err != nil {
+			return programState{}, fmt.Errorf("invalid sandbox helper report: %w", err)
+		}
+		if report.Error != "" {
+			return programState{}, errors.New(report.Error)
+		}
+	}
+
+	// Killed on timeout before anything could be reported
+	if ctx.Err() != nil {
+		return programState{Signal: syscall.SIGKILL, ExitCode: -1}, nil
+	}
+
+	if cfg.Isolated {
+		if report.State == nil {
+			return programState{}, fmt.Errorf("sandbox helper exited without a report: %v", waitErr)
+		}
+		return *report.State, nil
+	}
+
+	if waitErr != nil {
+		if _, ok := waitErr.(*exec.ExitError); !ok {
+			return programState{}, waitErr
+		}
+	}
+
+	return stateFromProcess(cmd.ProcessState.Sys().(syscall.WaitStatus), cmd.ProcessState.SysUsage().(*syscall.Rusage)), nil
+}
+
+// stateFromProcess converts a wait status and resource usage into a programState
+func stateFromProcess(status syscall.WaitStatus, usage *syscall.Rusage) programState {
+	state := programState{
+		ExitCode: status.ExitStatus(),
+		Memory:   int(usage.Maxrss),
+		CPUTime:  int((usage.Utime.Nano() + usage.Stime.Nano()) / int64(time.Millisecond)),
+	}
+	if status.Signaled() {
+		state.Signal = status.Signal()
+		state.Restricted = state.Signal == syscall.SIGSYS
+		state.FileTooBig = state.Signal == syscall.SIGXFSZ
+	}
+
+	return state
+}
+
+// writeReport writes a helper report on helperReportFD
+func writeReport(report helperReport) {
+	data, _ := json.Marshal(report)
+	f := os.NewFile(helperReportFD, "report")
+	f.Write(data)
+	f.Close()
+}
+
+// helperFail reports a setup failure and exits
+func helperFail(format string, args ...interface{}) {
+	writeReport(helperReport{Error: fmt.Sprintf(format, args...)})
+	os.Exit(127)
+}
+
+// runExecHelper applies the limits from the encoded config and replaces the
+// current process with the user program. It never returns.
+func runExecHelper(encoded string) {
+	// Seccomp filters and no_new_privs apply to the calling thread only
+	runtime.LockOSThread()
+
+	var hc helperConfig
+	if err := json.Unmarshal([]byte(encoded), &hc); err != nil {
+		helperFail("sandbox exec: invalid config: %v", err)
+	}
+
+	// The report descriptor must not leak into the user program
+	syscall.CloseOnExec(helperReportFD)
+
+	// Prepare execve arguments up front so nothing is allocated once the
+	// limits are in place
+	path, err := syscall.BytePtrFromString(hc.Executable)
+	if err != nil {
+		helperFail("sandbox exec: invalid executable: %v", err)
+	}
+	argv, err := syscall.SlicePtrFromStrings(append([]string{hc.Executable}, hc.Args...))
+	if err != nil {
+		helperFail("sandbox exec: invalid arguments: %v", err)
+	}
+	envv, err := syscall.SlicePtrFromStrings(os.Environ())
+	if err != nil {
+		helperFail("sandbox exec: invalid environment: %v", err)
+	}
+	filter := seccompFilter(uintptr(unsafe.Pointer(path)))
+
+	limits := []rlimit{{syscall.RLIMIT_CORE, 0}}
+	if hc.TimeLimit > 0 {
+		// RLIMIT_CPU counts whole seconds; it only stops runaway programs,
+		// the measured CPU time decides whether the limit was exceeded. The
+		// soft limit sends SIGXCPU, the hard limit a second later SIGKILL.
+		seconds := uint64(hc.TimeLimit+999)/1000 + 1
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: seconds, Max: seconds + 1}); err != nil {
+			helperFail("sandbox exec: setrlimit %d: %v", syscall.RLIMIT_CPU, err)
+		}
+	}
+	if hc.MemoryLimit > 0 {
+		limit := uint64(hc.MemoryLimit) * 1024
+		limits = append(limits, rlimit{syscall.RLIMIT_STACK, limit})
+		if !hc.Sanitized {
+			limits = append(limits, rlimit{syscall.RLIMIT_AS, limit + addressSpaceSlack*1024})
+		}
+	}
+	if hc.FileLimit > 0 {
+		limits = append(limits, rlimit{syscall.RLIMIT_FSIZE, uint64(hc.FileLimit) * 1024})
+	}
+	if hc.ProcessLimit > 0 {
+		limits = append(limits, rlimit{rlimitNproc, uint64(hc.ProcessLimit)})
+	}
+
+	for _, l := range limits {
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			helperFail("sandbox exec: setrlimit %d: %v", l.resource, err)
+		}
+	}
+
+	if filter != nil {
+		if err := installSeccomp(filter); err != nil {
+			helperFail("sandbox exec: %v", err)
+		}
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE,
+		uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&argv[0])),
+		uintptr(unsafe.Pointer(&envv[0])))
+	helperFail("sandbox exec: exec %s: %v", hc.Executable, errno)
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// isolationSupported reports whether programs can be run in namespaces.
+// Isolation and resource limits are only implemented on Linux.
+func isolationSupported() error {
+	return errors.New("process isolation requires Linux")
+}
+
+// runProgram runs the executable directly without any limits besides ctx
+func runProgram(ctx context.Context, cfg programConfig, stdin io.Reader, stdout, stderr io.Writer) (programState, error) {
+	cmd := exec.CommandContext(ctx, cfg.Executable, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(append([]string{}, programEnv...), cfg.Env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return programState{}, err
+		}
+	}
+
+	state := programState{
+		ExitCode: cmd.ProcessState.ExitCode(),
+		CPUTime:  int((cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()).Milliseconds()),
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		state.Signal = status.Signal()
+	}
+
+	return state, nil
+}
@@ -0,0 +1,132 @@
+package sandbox
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CompilerProfile is a named set of compiler flags for one language, so that
+// problems can reproduce the conditions of official contests
+type CompilerProfile struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`     // Display name
+	Language string   `json:"language"` // ID of the language the profile applies to
+	Flags    []string `json:"flags"`    // Passed to the compiler before the language's CompileArgs
+}
+
+// compilerProfiles is the registry of compiler profiles, by ID. Every
+// language's DefaultProfile must be listed here.
+var compilerProfiles = map[string]CompilerProfile{
+	"c11-o2": {
+		ID:       "c11-o2",
+		Name:     "C11 -O2",
+		Language: "c11",
+		Flags:    []string{"-std=c11", "-O2", "-Wall"},
+	},
+	"cpp11-o2": {
+		ID:       "cpp11-o2",
+		Name:     "C++11 -O2",
+		Language: "cpp11",
+		Flags:    []string{"-std=c++11", "-O2", "-Wall"},
+	},
+	"cpp14-o2": {
+		ID:       "cpp14-o2",
+		Name:     "C++14 -O2",
+		Language: "cpp14",
+		Flags:    []string{"-std=c++14", "-O2", "-Wall"},
+	},
+	// NOI 系列比赛的官方编译选项
+	"noi": {
+		ID:       "noi",
+		Name:     "NOI (C++14 -O2)",
+		Language: "cpp14",
+		Flags:    []string{"-std=c++14", "-O2"},
+	},
+	"cpp17-o2": {
+		ID:       "cpp17-o2",
+		Name:     "C++17 -O2",
+		Language: "cpp17",
+		Flags:    []string{"-std=c++17", "-O2", "-Wall"},
+	},
+	"cpp17-o0": {
+		ID:       "cpp17-o0",
+		Name:     "C++17 (no optimization)",
+		Language: "cpp17",
+		Flags:    []string{"-std=c++17", "-O0", "-Wall"},
+	},
+	"cpp20-o2": {
+		ID:       "cpp20-o2",
+		Name:     "C++20 -O2",
+		Language: "cpp20",
+		Flags:    []string{"-std=c++20", "-O2", "-Wall"},
+	},
+	"python3": {
+		ID:       "python3",
+		Name:     "Python 3",
+		Language: "python3",
+	},
+}
+
+// LookupCompilerProfile returns the compiler profile with the given ID
+func LookupCompilerProfile(id string) (CompilerProfile, bool) {
+	profile, ok := compilerProfiles[id]
+	return profile, ok
+}
+
+// CompilerProfiles returns all compiler profiles sorted by ID
+func CompilerProfiles() []CompilerProfile {
+	list := make([]CompilerProfile, 0, len(compilerProfiles))
+	for _, profile := range compilerProfiles {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// SelectCompilerProfile picks the compiler profile for a submission in the
+// given language. A requested profile must belong to the language. If allowed
+// is not empty, only the profiles it lists may be used; without a request the
+// language's default profile is preferred, then the first allowed profile of
+// the language.
+func SelectCompilerProfile(language Language, requested string, allowed []string) (CompilerProfile, error) {
+	isAllowed := func(id string) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+		for _, a := range allowed {
+			if a == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	if requested != "" {
+		profile, ok := LookupCompilerProfile(requested)
+		if !ok {
+			return CompilerProfile{}, fmt.Errorf("unknown compiler profile: %s", requested)
+		}
+		if profile.Language != language.ID {
+			return CompilerProfile{}, fmt.Errorf("compiler profile %s is not for language %s", requested, language.ID)
+		}
+		if !isAllowed(profile.ID) {
+			return CompilerProfile{}, fmt.Errorf("compiler profile %s is not allowed for this problem", requested)
+		}
+		return profile, nil
+	}
+
+	if isAllowed(language.DefaultProfile) {
+		if profile, ok := LookupCompilerProfile(language.DefaultProfile); ok {
+			return profile, nil
+		}
+	}
+	for _, id := range allowed {
+		if profile, ok := LookupCompilerProfile(id); ok && profile.Language == language.ID {
+			return profile, nil
+		}
+	}
+
+	return CompilerProfile{}, fmt.Errorf("language %s is not allowed for this problem", language.ID)
+}
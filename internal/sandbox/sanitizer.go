@@ -0,0 +1,84 @@
+package sandbox
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sanitizerFlags are added after a compiler profile's flags for debug builds.
+// Optimization is turned off so that reported lines match the source.
+var sanitizerFlags = []string{"-fsanitize=address,undefined", "-fno-omit-frame-pointer", "-g", "-O0"}
+
+// sanitizerReportLimit caps a sanitizer report, in bytes. Reports of deep
+// recursion list every stack frame.
+const sanitizerReportLimit = 16 * 1024
+
+// sanitizerProcessSlack is added to the process limit of debug builds to let
+// the sanitizer start its memory watchdog thread. RLIMIT_NPROC counts every
+// process of the user on the host, so a single extra slot is not enough.
+const sanitizerProcessSlack = 32
+
+// sanitizerMemoryFactor scales the memory limit of debug builds, whose
+// resident memory includes shadow memory and the red zones around objects
+const sanitizerMemoryFactor = 2
+
+// sanitizerReportStart matches the first line of an AddressSanitizer or
+// UndefinedBehaviorSanitizer report
+var sanitizerReportStart = regexp.MustCompile(`(?m)^(=+\n==\d+==ERROR: |==\d+==ERROR: |.*: runtime error: )`)
+
+// sanitizerEnv configures the sanitizer runtimes. The first undefined
+// behavior ends the program like a memory error does, and leak detection is
+// off because it needs to trace the program. Since the address space cannot
+// be capped, single allocations are limited to the memory limit and a
+// watchdog thread of the runtime kills the program once its resident memory
+// exceeds the scaled limit.
+func sanitizerEnv(memoryLimit int) []string {
+	asanOptions := "detect_leaks=0:print_legend=0:color=never:quarantine_size_mb=16"
+	if memoryLimit > 0 {
+		limit := (memoryLimit + 1023) / 1024
+		asanOptions += fmt.Sprintf(":max_allocation_size_mb=%d:hard_rss_limit_mb=%d", limit, limit*sanitizerMemoryFactor)
+	}
+	return []string{
+		"ASAN_OPTIONS=" + asanOptions,
+		"UBSAN_OPTIONS=halt_on_error=1:print_stacktrace=1:color=never",
+	}
+}
+
+// CompileDebug builds code like CompileLanguage, instrumented with
+// AddressSanitizer and UndefinedBehaviorSanitizer so that runtime errors such
+// as out-of-bounds indexes and signed overflow are reported with the source
+// line. Only compiled languages can be instrumented.
+func (s *CppSandbox) CompileDebug(language Language, flags []string, code string) (*Artifact, error) {
+	if language.Interpreter != "" {
+		return nil, fmt.Errorf("debug builds are not supported for %s", language.Name)
+	}
+
+	artifact, err := s.CompileLanguage(language, append(append([]string{}, flags...), sanitizerFlags...), code)
+	if err != nil {
+		return nil, err
+	}
+	artifact.sanitized = true
+
+	return artifact, nil
+}
+
+// SanitizerReport extracts the sanitizer report from the error output of a
+// run of a debug build, with source paths relative to the build directory.
+// It returns an empty string if no sanitizer reported an error.
+func (a *Artifact) SanitizerReport(errorOutput string) string {
+	loc := sanitizerReportStart.FindStringIndex(errorOutput)
+	if loc == nil {
+		return ""
+	}
+
+	report := strings.ReplaceAll(errorOutput[loc[0]:], a.dir+string(filepath.Separator), "")
+	report = strings.ReplaceAll(report, "/program/", "")
+	if len(report) > sanitizerReportLimit {
+		// Cut at a line break so that no frame is shown half
+		report = report[:strings.LastIndexByte(report[:sanitizerReportLimit], '\n')+1] + "...\n"
+	}
+
+	return report
+}
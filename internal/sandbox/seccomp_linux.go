@@ -0,0 +1,153 @@
+package sandbox
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Seccomp constants missing from the syscall package
+const (
+	prSetNoNewPrivs        = 38
+	prSetSeccomp           = 22
+	seccompModeFilter      = 2
+	seccompRetKillProcess  = 0x80000000
+	seccompRetErrno        = 0x00050000
+	seccompRetAllow        = 0x7fff0000
+	seccompDataNr          = 0
+	seccompDataArch        = 4
+	seccompDataArgs        = 16
+	x32SyscallBit          = 0x40000000
+	seccompFilterMaxLength = 4096
+)
+
+// bpfInstruction is a classic BPF instruction whose jump targets are labels,
+// resolved into offsets by assemble
+type bpfInstruction struct {
+	code   uint16
+	k      uint32
+	label  string // label of this instruction, if any
+	jTrue  string
+	jFalse string
+}
+
+func bpfStmt(code uint16, k uint32) bpfInstruction {
+	return bpfInstruction{code: code, k: k}
+}
+
+func bpfJump(code uint16, k uint32, jTrue, jFalse string) bpfInstruction {
+	return bpfInstruction{code: code, k: k, jTrue: jTrue, jFalse: jFalse}
+}
+
+func bpfLabel(label string, ins bpfInstruction) bpfInstruction {
+	ins.label = label
+	return ins
+}
+
+// assemble resolves labels into relative jump offsets. An empty label means
+// falling through to the next instruction.
+func assemble(program []bpfInstruction) []syscall.SockFilter {
+	labels := make(map[string]int)
+	for i, ins := range program {
+		if ins.label != "" {
+			labels[ins.label] = i
+		}
+	}
+
+	offset := func(from int, label string) uint8 {
+		if label == "" {
+			return 0
+		}
+		to, ok := labels[label]
+		if !ok || to <= from || to-from-1 > 255 {
+			panic(fmt.Sprintf("seccomp: invalid jump from %d to %q", from, label))
+		}
+		return uint8(to - from - 1)
+	}
+
+	filter := make([]syscall.SockFilter, len(program))
+	for i, ins := range program {
+		filter[i] = syscall.SockFilter{
+			Code: ins.code,
+			Jt:   offset(i, ins.jTrue),
+			Jf:   offset(i, ins.jFalse),
+			K:    ins.k,
+		}
+	}
+
+	return filter
+}
+
+// seccompFilter builds the syscall allowlist for user programs. execve is
+// only allowed with execPath as its path argument, which is the pointer the
+// exec helper passes when replacing itself with the program; clone is only
+// allowed for threads, so programs cannot start new processes. Anything not
+// listed kills the program with SIGSYS.
+//
+// Returns nil on architectures without an allowlist.
+func seccompFilter(execPath uintptr) []syscall.SockFilter {
+	if len(allowedSyscalls) == 0 {
+		return nil
+	}
+
+	const (
+		ld   = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+		jeq  = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jge  = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+		jset = syscall.BPF_JMP | syscall.BPF_JSET | syscall.BPF_K
+		ret  = syscall.BPF_RET | syscall.BPF_K
+	)
+
+	program := []bpfInstruction{
+		bpfStmt(ld, seccompDataArch),
+		bpfJump(jeq, auditArch, "", "kill"),
+		bpfStmt(ld, seccompDataNr),
+		bpfJump(jge, x32SyscallBit, "kill", ""),
+	}
+	for _, nr := range allowedSyscalls {
+		program = append(program, bpfJump(jeq, nr, "allow", ""))
+	}
+	program = append(program,
+		bpfJump(jeq, syscall.SYS_EXECVE, "execve", ""),
+		bpfJump(jeq, syscall.SYS_CLONE, "clone", ""),
+		// Let libc fall back from clone3 to clone, which can be inspected
+		bpfJump(jeq, sysClone3, "enosys", ""),
+		bpfStmt(ret, seccompRetKillProcess),
+
+		bpfLabel("execve", bpfStmt(ld, seccompDataArgs)),
+		bpfJump(jeq, uint32(execPath), "", "kill"),
+		bpfStmt(ld, seccompDataArgs+4),
+		bpfJump(jeq, uint32(uint64(execPath)>>32), "allow", "kill"),
+
+		bpfLabel("clone", bpfStmt(ld, seccompDataArgs)),
+		bpfJump(jset, syscall.CLONE_THREAD, "allow", "kill"),
+
+		bpfLabel("allow", bpfStmt(ret, seccompRetAllow)),
+		bpfLabel("enosys", bpfStmt(ret, seccompRetErrno|uint32(syscall.ENOSYS))),
+		bpfLabel("kill", bpfStmt(ret, seccompRetKillProcess)),
+	)
+
+	return assemble(program)
+}
+
+// installSeccomp installs filter for the calling thread. no_new_privs is set
+// first, which also lets unprivileged processes install filters.
+func installSeccomp(filter []syscall.SockFilter) error {
+	if len(filter) > seccompFilterMaxLength {
+		return fmt.Errorf("seccomp filter too long: %d instructions", len(filter))
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %v", errno)
+	}
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_SECCOMP): %v", errno)
+	}
+
+	return nil
+}
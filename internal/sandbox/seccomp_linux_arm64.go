@@ -0,0 +1,47 @@
+package sandbox
+
+import "syscall"
+
+// auditArch is AUDIT_ARCH_AARCH64
+const auditArch = 0xc00000b7
+
+// Syscall numbers missing from the syscall package
+const (
+	sysGetrandom  = 278
+	sysStatx      = 291
+	sysRseq       = 293
+	sysClone3     = 435
+	sysFaccessat2 = 439
+)
+
+// allowedSyscalls are the syscalls user programs may make without restriction
+var allowedSyscalls = []uint32{
+	// Files and descriptors
+	syscall.SYS_READ, syscall.SYS_WRITE, syscall.SYS_OPENAT, syscall.SYS_CLOSE,
+	syscall.SYS_FSTAT, syscall.SYS_FSTATAT, sysStatx, syscall.SYS_FSTATFS, syscall.SYS_LSEEK,
+	syscall.SYS_IOCTL, syscall.SYS_PREAD64, syscall.SYS_PWRITE64, syscall.SYS_READV, syscall.SYS_WRITEV,
+	syscall.SYS_FACCESSAT, sysFaccessat2, syscall.SYS_READLINKAT, syscall.SYS_GETCWD,
+	syscall.SYS_GETDENTS64, syscall.SYS_DUP, syscall.SYS_DUP3, syscall.SYS_FCNTL,
+
+	// Memory
+	syscall.SYS_MMAP, syscall.SYS_MPROTECT, syscall.SYS_MUNMAP, syscall.SYS_BRK, syscall.SYS_MREMAP,
+	syscall.SYS_MADVISE, syscall.SYS_MINCORE,
+
+	// Signals
+	syscall.SYS_RT_SIGACTION, syscall.SYS_RT_SIGPROCMASK, syscall.SYS_RT_SIGRETURN,
+	syscall.SYS_SIGALTSTACK, syscall.SYS_TGKILL, syscall.SYS_KILL,
+
+	// Time
+	syscall.SYS_NANOSLEEP, syscall.SYS_CLOCK_NANOSLEEP, syscall.SYS_CLOCK_GETTIME,
+	syscall.SYS_CLOCK_GETRES, syscall.SYS_GETTIMEOFDAY,
+
+	// Process information
+	syscall.SYS_GETPID, syscall.SYS_GETTID, syscall.SYS_GETPPID, syscall.SYS_GETUID,
+	syscall.SYS_GETEUID, syscall.SYS_GETGID, syscall.SYS_GETEGID, syscall.SYS_UNAME,
+	syscall.SYS_SYSINFO, syscall.SYS_TIMES, syscall.SYS_GETRUSAGE, syscall.SYS_GETRLIMIT,
+	syscall.SYS_PRLIMIT64, syscall.SYS_SCHED_GETAFFINITY, syscall.SYS_SCHED_YIELD, sysGetrandom,
+
+	// Runtime and threads
+	syscall.SYS_SET_TID_ADDRESS, syscall.SYS_SET_ROBUST_LIST, sysRseq,
+	syscall.SYS_FUTEX, syscall.SYS_EXIT, syscall.SYS_EXIT_GROUP,
+}
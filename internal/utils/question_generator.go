@@ -223,7 +223,7 @@ func generateMultipleChoiceQuestion(item OutlineItem) (content string, options [
 	}
 
 	// 设置答案 (A, B, C, D)
-	answer = string('A' + correctIndex)
+	answer = string(rune('A' + correctIndex))
 
 	// 生成解释
 	explanation = generateExplanation(item, options[correctIndex])
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -21,8 +25,12 @@ func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	log.Println("C++在线评测系统启动中...")
 
-	// 创建内存存储
-	store := db.NewMemoryStore()
+	// 创建存储：默认使用内存存储并保存为 data 目录下的JSON文件，DB_DRIVER=sqlite 时使用SQLite数据库文件
+	store, err := openStore()
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
 
 	// 初始化沙箱
 	sandbox, err := sandbox.NewCppSandbox()
@@ -31,11 +39,38 @@ func main() {
 	}
 	defer sandbox.Cleanup()
 
+	// 编译缓存大小（MB），为0时关闭缓存
+	if envCacheSize := os.Getenv("COMPILE_CACHE_MB"); envCacheSize != "" {
+		if n, err := strconv.Atoi(envCacheSize); err == nil && n >= 0 {
+			sandbox.CacheSize = int64(n) << 20
+		}
+	}
+
 	// 初始化判题器
 	judgeService := judge.NewJudge(store, sandbox)
 
+	// 初始化判题队列，限制同时评测的提交数量
+	workers := runtime.NumCPU()
+	if envWorkers := os.Getenv("JUDGE_WORKERS"); envWorkers != "" {
+		if n, err := strconv.Atoi(envWorkers); err == nil && n > 0 {
+			workers = n
+		}
+	}
+	queueSize := 1000
+	if envQueueSize := os.Getenv("JUDGE_QUEUE_SIZE"); envQueueSize != "" {
+		if n, err := strconv.Atoi(envQueueSize); err == nil && n > 0 {
+			queueSize = n
+		}
+	}
+	judgeQueue := judge.NewQueue(judgeService, workers, queueSize)
+
+	// 上次关闭时仍在等待或评测中的提交重新排队
+	if _, err := judgeQueue.Recover(); err != nil {
+		log.Printf("恢复未完成的评测失败: %v", err)
+	}
+
 	// 创建API处理器
-	handler := api.NewHandler(store, judgeService)
+	handler := api.NewHandler(store, judgeService, judgeQueue)
 
 	// 设置路由
 	mux := api.SetupRoutes(handler)
@@ -84,9 +119,33 @@ func main() {
 		log.Fatalf("服务器关闭异常: %v", err)
 	}
 
+	// 评测队列中剩余的提交，超时未评测的在下次启动时重新排队
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer drainCancel()
+
+	if err := judgeQueue.Shutdown(drainCtx); err != nil {
+		log.Printf("等待评测任务完成超时: %v", err)
+	}
+
 	log.Println("服务器已安全关闭")
 }
 
+// openStore 根据 DB_DRIVER 创建存储，SQLite数据库文件的路径由 DB_PATH 指定
+func openStore() (db.Store, error) {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "memory":
+		return db.NewMemoryStore(), nil
+	case "sqlite":
+		path := filepath.Join("data", "cppjudge.db")
+		if envPath := os.Getenv("DB_PATH"); envPath != "" {
+			path = envPath
+		}
+		return db.NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, expected sqlite or memory", driver)
+	}
+}
+
 // setupGracefulShutdown 设置信号处理来处理优雅关闭
 func setupGracefulShutdown() <-chan struct{} {
 	stopChan := make(chan struct{})
@@ -102,12 +161,16 @@ func setupGracefulShutdown() <-chan struct{} {
 }
 
 // addSampleData adds sample problems and test cases for demo purposes
-func addSampleData(store *db.MemoryStore) {
-	// Add a test user
+func addSampleData(store db.Store) {
+	// Add a test user, unless it was kept from a previous run
+	if _, err := store.GetUserByUsername("testuser"); err == nil {
+		log.Println("示例数据处理完成")
+		return
+	}
 	user := models.User{
 		Username: "testuser",
 		Email:    "test@example.com",
-		Password: "password", // In a real app, this would be hashed
+		Password: "password", // The store keeps only its bcrypt hash
 	}
 	_, err := store.AddUser(user)
 	if err != nil {
@@ -35,13 +35,26 @@ const difficultyTranslation = {
 const statusTranslation = {
     'Accepted': '通过',
     'Wrong Answer': '答案错误',
+    'Presentation Error': '格式错误',
     'Compilation Error': '编译错误',
     'Runtime Error': '运行时错误',
     'Time Limit Exceeded': '超时',
+    'Memory Limit Exceeded': '内存超限',
+    'Output Limit Exceeded': '输出超限',
+    'Restricted Function': '使用了受限函数',
     'Internal Error': '内部错误',
+    'Judgement Failed': '评测失败',
     'Pending': '评测中'
 };
 
+// Common causes of the signals that end programs with a runtime error
+const signalTranslation = {
+    'SIGSEGV': '段错误，可能是数组越界、空指针或递归过深',
+    'SIGFPE': '算术错误，可能是除以零',
+    'SIGABRT': '程序中止，可能是 assert 失败或抛出了未捕获的异常',
+    'SIGBUS': '总线错误，可能是非法的内存访问'
+};
+
 // Current state
 let currentProblemId = null;
 let currentUser = { id: 1 }; // Mock user for demo purposes
@@ -474,8 +487,8 @@ async function submitSolution() {
         
         const data = await response.json();
         
-        // Poll for submission result
-        pollSubmissionResult(data.submission_id);
+        // Follow the judging progress
+        watchSubmission(data.submission_id);
     } catch (error) {
         console.error('Error submitting solution:', error);
         alert('提交解答时出错，请重试。');
@@ -486,13 +499,53 @@ async function submitSolution() {
     }
 }
 
+// Follow judging progress over Server-Sent Events, falling back to polling
+function watchSubmission(submissionId) {
+    if (!window.EventSource) {
+        pollSubmissionResult(submissionId);
+        return;
+    }
+
+    const source = new EventSource(`/api/submissions/${submissionId}/events`);
+    let testCount = 0;
+
+    source.addEventListener('status', event => {
+        const data = JSON.parse(event.data);
+        if (data.status === 'Pending') {
+            submitBtn.textContent = data.queue_position > 0 ? `排队中 (第${data.queue_position}位)...` : '评测中...';
+        } else {
+            submitBtn.textContent = '评测中...';
+        }
+    });
+
+    source.addEventListener('test_result', () => {
+        testCount++;
+        submitBtn.textContent = `评测中 (已完成${testCount}个测试点)...`;
+    });
+
+    source.addEventListener('done', () => {
+        source.close();
+        // Fetch the complete result once judging has finished
+        pollSubmissionResult(submissionId);
+    });
+
+    source.onerror = () => {
+        // The stream was interrupted; continue by polling
+        source.close();
+        pollSubmissionResult(submissionId);
+    };
+}
+
 // Poll for submission result
 async function pollSubmissionResult(submissionId) {
     try {
         const response = await fetch(`/api/submissions/${submissionId}`);
         const data = await response.json();
         
-        if (data.submission.status === 'Pending') {
+        if (data.submission.status === 'Pending' || data.submission.status === 'Testing') {
+            // Show the position in the judge queue while waiting
+            submitBtn.textContent = data.queue_position > 0 ? `排队中 (第${data.queue_position}位)...` : '评测中...';
+
             // If still pending, poll again after a delay
             setTimeout(() => pollSubmissionResult(submissionId), 1000);
             return;
@@ -526,10 +579,41 @@ function renderSubmissionResult(submission, testResults) {
         <div>
             <strong>运行时间:</strong> ${submission.run_time}ms
             <strong>内存:</strong> ${submission.memory}KB
+            <strong>得分:</strong> ${submission.score}
         </div>
     `;
+
+    // Show subtask scores
+    if (submission.subtask_results && submission.subtask_results.length > 0) {
+        detailsHtml += '<h3>子任务</h3>';
+
+        submission.subtask_results.forEach(subtask => {
+            const translatedSubtaskStatus = statusTranslation[subtask.status] || subtask.status;
+            detailsHtml += `
+                <div class="test-case-result">
+                    <h4>子任务 ${subtask.subtask}: ${translatedSubtaskStatus} (${subtask.score}/${subtask.max_score})</h4>
+                </div>
+            `;
+        });
+    }
+    
+    // Show compiler diagnostics
+    if (submission.compile_output) {
+        detailsHtml += `
+            <h3>编译信息</h3>
+            <div class="test-output">${escapeHtml(submission.compile_output)}</div>
+        `;
+    }
+    
+    // Show the sanitizer report of a debug run
+    if (submission.debug_report) {
+        detailsHtml += `
+            <h3>调试信息</h3>
+            <div class="test-output">${escapeHtml(submission.debug_report)}</div>
+        `;
+    }
     
-    // Show test results
+    // Show test results; inputs and outputs are only available for example tests
     if (testResults && testResults.length > 0) {
         detailsHtml += '<h3>测试结果</h3>';
         
@@ -537,11 +621,38 @@ function renderSubmissionResult(submission, testResults) {
             const translatedResultStatus = statusTranslation[result.status] || result.status;
             detailsHtml += `
                 <div class="test-case-result">
-                    <h4>测试用例 ${index + 1}: ${translatedResultStatus}</h4>
-                    ${result.status !== 'Accepted' ? `
+                    <h4>测试用例 ${result.index || index + 1}${result.is_example ? ' (样例)' : ''}: ${translatedResultStatus}
+                        <span class="test-case-stats">${result.run_time}ms / ${result.memory}KB</span>
+                    </h4>
+                    ${result.signal ? `
+                        <div>
+                            <strong>信号:</strong> ${escapeHtml(result.signal)}${signalTranslation[result.signal] ? ` (${signalTranslation[result.signal]})` : ''}
+                        </div>
+                    ` : ''}
+                    ${result.message ? `
+                        <div>
+                            <strong>评测信息:</strong>
+                            <div class="test-output">${escapeHtml(result.message)}</div>
+                        </div>
+                    ` : ''}
+                    ${result.is_example && result.status !== 'Accepted' ? `
+                        <div>
+                            <strong>输入:</strong>
+                            <div class="test-output">${escapeHtml(result.input || '')}</div>
+                        </div>
+                        <div>
+                            <strong>期望输出:</strong>
+                            <div class="test-output">${escapeHtml(result.expected_output || '')}</div>
+                        </div>
                         <div>
                             <strong>你的输出:</strong>
-                            <div class="test-output">${result.output}</div>
+                            <div class="test-output">${escapeHtml(result.output || '')}</div>
+                        </div>
+                    ` : ''}
+                    ${result.diff ? `
+                        <div>
+                            <strong>第 ${result.diff.line} 行不同:</strong>
+                            <div class="test-output">期望: ${escapeHtml(result.diff.expected)}\n实际: ${escapeHtml(result.diff.actual)}</div>
                         </div>
                     ` : ''}
                 </div>
@@ -556,6 +667,16 @@ function renderSubmissionResult(submission, testResults) {
     submissionResult.style.display = 'block';
 }
 
+// Escape text for safe insertion into HTML
+function escapeHtml(text) {
+    return String(text)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
 // Navigate back to problems list
 function goBackToProblems() {
     // 清除题目详情内容
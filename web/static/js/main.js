@@ -290,6 +290,8 @@ function showProblemDetail(data) {
                         <span class="badge bg-info">难度: ${difficulty}</span>
                         <span class="badge bg-secondary">时间限制: ${timeLimit}ms</span>
                         <span class="badge bg-secondary">内存限制: ${memoryLimit}KB</span>
+                        ${problem.io_mode === 'file' ? `<span class="badge bg-warning text-dark">文件输入输出: ${problem.io_file_name}.in / ${problem.io_file_name}.out</span>` : ''}
+                        ${problem.interactor ? '<span class="badge bg-warning text-dark">交互题：每次输出后请刷新缓冲区</span>' : ''}
                     </div>
                     
                     <h6>题目描述:</h6>
@@ -337,13 +339,31 @@ function showProblemDetail(data) {
                     </div>
                     ` : ''}
                     
-                    <h6>提交代码:</h6>
+                    <div class="d-flex justify-content-between align-items-center mb-2">
+                        <h6 class="mb-0">提交代码:</h6>
+                        <div class="d-flex">
+                            <select class="form-select form-select-sm w-auto" id="languageSelect"></select>
+                            <select class="form-select form-select-sm w-auto ms-2" id="compilerProfileSelect"></select>
+                        </div>
+                    </div>
                     <div class="code-submission">
                         <textarea class="form-control code-editor" id="codeSubmission" rows="10"></textarea>
                     </div>
+                    
+                    <h6 class="mt-3">自定义输入:</h6>
+                    <textarea class="form-control" id="customInput" rows="3"></textarea>
+                    <div id="runResult" class="mt-2" style="display: none;">
+                        <div id="runStatus" class="small mb-1"></div>
+                        <pre id="runOutput" class="bg-light p-2 mb-0"></pre>
+                    </div>
                 </div>
                 <div class="modal-footer">
+                    <div class="form-check me-auto" title="运行错误时用 AddressSanitizer 和 UndefinedBehaviorSanitizer 重新运行样例，定位越界、溢出等问题">
+                        <input class="form-check-input" type="checkbox" id="debugSubmission">
+                        <label class="form-check-label" for="debugSubmission">调试模式</label>
+                    </div>
                     <button type="button" class="btn btn-secondary" data-bs-dismiss="modal">关闭</button>
+                    <button type="button" class="btn btn-outline-primary" id="runCodeBtn">运行</button>
                     <button type="button" class="btn btn-primary" id="submitCodeBtn" data-problem-id="${problem.id}">提交代码</button>
                 </div>
             </div>
@@ -368,6 +388,15 @@ function showProblemDetail(data) {
     if (submitCodeBtn) {
         submitCodeBtn.addEventListener('click', () => submitCode(problem.id));
     }
+    
+    // 加载可选的编程语言
+    loadLanguages(problem.compiler_profiles || []);
+    
+    // 添加自定义输入运行的事件监听器
+    const runCodeBtn = document.getElementById('runCodeBtn');
+    if (runCodeBtn) {
+        runCodeBtn.addEventListener('click', () => runCode(problem.id));
+    }
 }
 
 // 渲染题目样例
@@ -432,7 +461,9 @@ async function submitCode(problemId) {
             body: JSON.stringify({
                 user_id: currentUser.id,
                 problem_id: problemId,
-                language: 'cpp',
+                language: selectedLanguage(),
+                compiler_profile: selectedCompilerProfile(),
+                debug: document.getElementById('debugSubmission').checked,
                 code: code
             })
         });
@@ -470,6 +501,135 @@ async function submitCode(problemId) {
     }
 }
 
+// 加载支持的编程语言到语言选择框，allowedProfiles 为题目允许的编译配置
+async function loadLanguages(allowedProfiles) {
+    const languageSelect = document.getElementById('languageSelect');
+    if (!languageSelect) {
+        return;
+    }
+    
+    try {
+        const response = await fetch('/api/languages');
+        if (!response.ok) {
+            throw new Error(`获取语言列表失败 (${response.status})`);
+        }
+        const data = await response.json();
+        const selected = localStorage.getItem('preferredLanguage') || data.default;
+        
+        languageSelect.innerHTML = '';
+        data.languages.forEach(language => {
+            const option = document.createElement('option');
+            option.value = language.id;
+            option.textContent = language.name;
+            option.selected = language.id === selected;
+            languageSelect.appendChild(option);
+        });
+        
+        const updateProfiles = () => updateCompilerProfiles(data.compiler_profiles, allowedProfiles);
+        updateProfiles();
+        languageSelect.addEventListener('change', () => {
+            localStorage.setItem('preferredLanguage', languageSelect.value);
+            updateProfiles();
+        });
+    } catch (error) {
+        console.error('加载语言列表失败:', error);
+    }
+}
+
+// 根据所选语言和题目限制更新编译配置选择框
+function updateCompilerProfiles(profiles, allowedProfiles) {
+    const profileSelect = document.getElementById('compilerProfileSelect');
+    if (!profileSelect) {
+        return;
+    }
+    
+    const language = selectedLanguage();
+    const available = profiles.filter(profile =>
+        profile.language === language &&
+        (allowedProfiles.length === 0 || allowedProfiles.includes(profile.id)));
+    
+    // 第一项留空，由服务器选择默认编译配置
+    profileSelect.innerHTML = '<option value="">默认编译配置</option>';
+    available.forEach(profile => {
+        const option = document.createElement('option');
+        option.value = profile.id;
+        option.textContent = profile.name;
+        profileSelect.appendChild(option);
+    });
+    profileSelect.style.display = available.length > 1 ? '' : 'none';
+}
+
+// 当前选择的编译配置，为空时使用默认配置
+function selectedCompilerProfile() {
+    const profileSelect = document.getElementById('compilerProfileSelect');
+    return profileSelect ? profileSelect.value : '';
+}
+
+// 当前选择的编程语言，未加载时由服务器使用默认语言
+function selectedLanguage() {
+    const languageSelect = document.getElementById('languageSelect');
+    return languageSelect ? languageSelect.value : '';
+}
+
+// 使用自定义输入运行代码，不计入提交记录
+async function runCode(problemId) {
+    const code = document.getElementById('codeSubmission').value.trim();
+    if (!code) {
+        alert('请输入代码');
+        return;
+    }
+    
+    const runCodeBtn = document.getElementById('runCodeBtn');
+    const runResult = document.getElementById('runResult');
+    const runStatus = document.getElementById('runStatus');
+    const runOutput = document.getElementById('runOutput');
+    
+    runCodeBtn.disabled = true;
+    runResult.style.display = 'block';
+    runStatus.textContent = '运行中...';
+    runOutput.textContent = '';
+    
+    try {
+        const response = await fetch(`/api/problems/${problemId}/run`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                user_id: currentUser.id,
+                code: code,
+                language: selectedLanguage(),
+                compiler_profile: selectedCompilerProfile(),
+                input: document.getElementById('customInput').value
+            })
+        });
+        
+        const result = await response.json();
+        if (!response.ok) {
+            if (response.status === 429) {
+                const retryAfter = response.headers.get('Retry-After');
+                throw new Error(`运行过于频繁，请${retryAfter || ''}秒后再试`);
+            }
+            throw new Error(result.error || `运行失败 (${response.status})`);
+        }
+        
+        if (result.status === 'Compilation Error') {
+            runStatus.textContent = '编译错误';
+            runOutput.textContent = result.compile_output || '';
+            return;
+        }
+        
+        runStatus.textContent = `${result.status} | 退出码: ${result.exit_code}${result.signal ? ` (${result.signal})` : ''} | CPU 时间: ${result.run_time}ms | 实际用时: ${result.wall_time}ms | 内存: ${result.memory}KB`;
+        runOutput.textContent = result.stdout + (result.stderr ? `\n[stderr]\n${result.stderr}` : '') +
+            (result.message ? `\n[交互程序]\n${result.message}` : '');
+    } catch (error) {
+        console.error('运行代码失败:', error);
+        runStatus.textContent = `运行代码失败: ${error.message}`;
+    } finally {
+        runCodeBtn.disabled = false;
+    }
+}
+
 // 显示创建题目模态框
 function showCreateProblemModal() {
     alert('创建题目功能正在开发中...');
@@ -556,6 +716,8 @@ function showImportProblemModal() {
                             <li><code>time_limit</code>: 时间限制 (毫秒)</li>
                             <li><code>memory_limit</code>: 内存限制 (KB)</li>
                             <li><code>knowledge_tag</code>: 知识点标签数组</li>
+                            <li><code>io_mode</code>: 输入输出方式，<code>stdio</code>（默认）或 <code>file</code></li>
+                            <li><code>io_file_name</code>: 文件输入输出的文件名，如 <code>sum</code> 表示读取 sum.in、写入 sum.out</li>
                             <li><code>test_cases</code>: 测试用例数组，每个测试用例包含:</li>
                             <ul>
                                 <li><code>input</code>: 输入数据</li>